@@ -0,0 +1,167 @@
+// Package checkpoint persists the summaries of a run as they are produced so
+// that an interrupted run can be resumed without summarizing everything again
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Path returns the checkpoint file of a digest profile inside dir
+func Path(dir, profile string) string {
+	return filepath.Join(dir, "checkpoint-"+profile+".json")
+}
+
+// Checkpoint holds the completed summaries of one run. It is keyed by the
+// Gmail message IDs the run started with, so a checkpoint written for a
+// different set of newsletters is never reused. A nil Checkpoint is valid and
+// records nothing.
+type Checkpoint struct {
+	Key         string            `json:"key"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Newsletters map[string]string `json:"newsletters"` // message ID -> summary
+	Posts       map[string]string `json:"posts"`       // LinkedIn post URL -> summary
+
+	path string
+	mu   sync.Mutex
+}
+
+// Key derives the checkpoint key from a set of message IDs. The order of the
+// IDs does not matter.
+func Key(messageIDs []string) string {
+	ids := append([]string(nil), messageIDs...)
+	sort.Strings(ids)
+
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// New starts an empty checkpoint for messageIDs of profile in dir, replacing
+// any checkpoint already there once the first summary is saved
+func New(dir, profile string, messageIDs []string) *Checkpoint {
+	return &Checkpoint{
+		Key:         Key(messageIDs),
+		CreatedAt:   time.Now(),
+		Newsletters: make(map[string]string),
+		Posts:       make(map[string]string),
+		path:        Path(dir, profile),
+	}
+}
+
+// Load reads the checkpoint of profile in dir. It returns nil and no error when
+// there is no checkpoint or when it was written for different message IDs.
+func Load(dir, profile string, messageIDs []string) (*Checkpoint, error) {
+	path := Path(dir, profile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint: %w", err)
+	}
+	if cp.Key != Key(messageIDs) {
+		return nil, nil
+	}
+
+	if cp.Newsletters == nil {
+		cp.Newsletters = make(map[string]string)
+	}
+	if cp.Posts == nil {
+		cp.Posts = make(map[string]string)
+	}
+	cp.path = path
+	return &cp, nil
+}
+
+// Newsletter returns the saved summary of a newsletter
+func (c *Checkpoint) Newsletter(id string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.Newsletters[id]
+	return s, ok
+}
+
+// Post returns the saved summary of a LinkedIn post
+func (c *Checkpoint) Post(url string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.Posts[url]
+	return s, ok
+}
+
+// SaveNewsletter records the summary of a newsletter and writes the checkpoint
+func (c *Checkpoint) SaveNewsletter(id, summary string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Newsletters[id] = summary
+	return c.write()
+}
+
+// SavePost records the summary of a LinkedIn post and writes the checkpoint
+func (c *Checkpoint) SavePost(url, summary string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Posts[url] = summary
+	return c.write()
+}
+
+// Remove deletes the checkpoint file once the run no longer needs it
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (c *Checkpoint) write() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package checkpoint
+
+import "testing"
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	ids := []string{"m1", "m2", "m3"}
+
+	cp := New(dir, "default", ids)
+	if err := cp.SaveNewsletter("m1", "- first"); err != nil {
+		t.Fatalf("SaveNewsletter failed: %v", err)
+	}
+	if err := cp.SavePost("https://www.linkedin.com/posts/1", "- post"); err != nil {
+		t.Fatalf("SavePost failed: %v", err)
+	}
+
+	// The same messages in a different order resume the checkpoint
+	loaded, err := Load(dir, "default", []string{"m3", "m1", "m2"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded == nil {
+		t.Fatal("Expected checkpoint to be loaded")
+	}
+	if s, ok := loaded.Newsletter("m1"); !ok || s != "- first" {
+		t.Errorf("Expected saved summary for m1, got %q (found=%v)", s, ok)
+	}
+	if _, ok := loaded.Newsletter("m2"); ok {
+		t.Error("Expected no summary for m2")
+	}
+	if s, ok := loaded.Post("https://www.linkedin.com/posts/1"); !ok || s != "- post" {
+		t.Errorf("Expected saved post summary, got %q (found=%v)", s, ok)
+	}
+
+	// Different messages invalidate it
+	loaded, err = Load(dir, "default", []string{"m1", "m2", "m4"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded != nil {
+		t.Error("Expected checkpoint for other messages to be ignored")
+	}
+
+	// Each profile has its own checkpoint
+	loaded, err = Load(dir, "other", ids)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded != nil {
+		t.Error("Expected no checkpoint for another profile")
+	}
+
+	if err := cp.Remove(); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	loaded, err = Load(dir, "default", ids)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded != nil {
+		t.Error("Expected no checkpoint after Remove")
+	}
+}
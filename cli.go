@@ -0,0 +1,705 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"newsletterdigest_go/config"
+	"newsletterdigest_go/credentials"
+	"newsletterdigest_go/gmail"
+	"newsletterdigest_go/ledger"
+	"newsletterdigest_go/logging"
+	"newsletterdigest_go/prompts"
+	"newsletterdigest_go/scheduler"
+)
+
+// command is a CLI subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"run", "Fetch newsletters, build the digest and email it (default)", runCommand},
+		{"daemon", "Stay running and build digests on a cron schedule", daemonCommand},
+		{"preview", "Render the digest locally (files or localhost server) instead of emailing it", previewCommand},
+		{"history", "List past runs recorded in the run ledger", historyCommand},
+		{"setup", "Encrypt and store Google OAuth credentials and authorize Gmail", setupCommand},
+		{"credentials", "Manage the credential store ('credentials rotate|export|import')", credentialsCommand},
+		{"secrets", "Keep API keys in the credential store ('secrets set|get|list|delete')", secretsCommand},
+		{"doctor", "Diagnose configuration, credentials and connectivity", doctorCommand},
+		{"config", "Show the effective configuration ('config print')", configCommand},
+		{"prompts", "Check the prompt templates against sample data ('prompts check')", promptsCommand},
+		{"version", "Print the version", versionCommand},
+	}
+}
+
+// dispatch runs the subcommand named by the first argument. Without a
+// subcommand (or when the first argument is a flag) the digest is run.
+func dispatch(args []string) error {
+	name := "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	for _, c := range commands() {
+		if c.name != name {
+			continue
+		}
+		err := c.run(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: newsletterdigest_go <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'newsletterdigest_go <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates a flag set for a subcommand that reports parse errors
+// instead of exiting
+func newFlagSet(name, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: newsletterdigest_go %s [flags]\n\n%s\n\nFlags:\n", name, summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// loadConfig loads the configuration from the config file and the
+// environment, applies the command-line flags on top of it and sets up the
+// logger it describes. The logger also becomes the slog default.
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, *slog.Logger, error) {
+	// The config file has to be read before the other flags are bound, since
+	// their defaults come from it
+	fs.String("config", "", "config file (CONFIG_FILE, default "+config.DefaultFile+" if present)")
+	cfg, loadErr := config.Load(configFlag(args))
+	cfg.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if loadErr != nil {
+		// Report the remaining problems along with the ones found while loading
+		return nil, nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(loadErr, cfg.Validate()))
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.SetDefault(logger)
+
+	return cfg, logger, nil
+}
+
+func runCommand(args []string) error {
+	fs := newFlagSet("run", "Fetch newsletters, build the digest and email it.")
+	reportFormat := fs.String("report-format", "text", "dry-run report format: text or json")
+	resume := fs.Bool("resume", false, "reuse the summaries of an interrupted run over the same newsletters")
+	var profiles []string
+	fs.Func("profile", "comma-separated profiles to run (default all)", setList(&profiles))
+	cfg, logger, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *reportFormat != "text" && *reportFormat != "json" {
+		return fmt.Errorf("invalid --report-format %q (want text or json)", *reportFormat)
+	}
+
+	ctx, cancel := setupContext()
+	defer cancel()
+
+	app, err := initializeApp(ctx, cfg, logger, profiles, runAccess(cfg))
+	if err != nil {
+		return fmt.Errorf("initialization failed: %w", err)
+	}
+	app.reportFormat = *reportFormat
+	app.resume = *resume
+
+	if err := app.run(ctx); err != nil {
+		return fmt.Errorf("application error: %w", err)
+	}
+	return nil
+}
+
+func previewCommand(args []string) error {
+	fs := newFlagSet("preview", "Render the digest, model output and per-item summaries locally.\nNothing is sent and no email is marked as read.")
+	out := fs.String("out", "digest-preview", "directory to write the digest HTML, model output and summaries to")
+	port := fs.Int("serve-port", 0, "serve the digest on this localhost port with auto-refresh instead of writing files")
+	var profiles []string
+	fs.Func("profile", "comma-separated profiles to preview (default all)", setList(&profiles))
+	cfg, logger, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := setupContext()
+	defer cancel()
+
+	app, err := initializeApp(ctx, cfg, logger, profiles, gmail.Access{})
+	if err != nil {
+		return fmt.Errorf("initialization failed: %w", err)
+	}
+
+	if err := app.preview(ctx, *out, *port); err != nil {
+		return fmt.Errorf("preview failed: %w", err)
+	}
+	return nil
+}
+
+func daemonCommand(args []string) error {
+	fs := newFlagSet("daemon", "Stay running and run each profile's digest on its cron schedule.\nRuns of a profile never overlap; SIGINT/SIGTERM stop the daemon after the current runs.")
+	resume := fs.Bool("resume", false, "reuse the summaries of an interrupted run over the same newsletters")
+	var profiles []string
+	fs.Func("profile", "comma-separated profiles to schedule (default all)", setList(&profiles))
+	cfg, logger, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := setupContext()
+	defer cancel()
+
+	app, err := initializeApp(ctx, cfg, logger, profiles, runAccess(cfg))
+	if err != nil {
+		return fmt.Errorf("initialization failed: %w", err)
+	}
+	app.resume = *resume
+
+	var jobs []scheduler.Job
+	for _, p := range app.profiles {
+		if p.cfg.Schedule == "" {
+			return fmt.Errorf("no schedule configured for profile %s (SCHEDULE, PROFILE_<NAME>_SCHEDULE or --schedule)", p.cfg.Profile)
+		}
+		jobs = append(jobs, scheduler.Job{
+			Name: p.cfg.Profile,
+			Spec: p.cfg.Schedule,
+			Run: func(ctx context.Context) error {
+				return app.runProfiles(ctx, []*profile{p})
+			},
+		})
+	}
+
+	sched, err := scheduler.New(cfg.StateDir, cfg.CatchUpMissed, logger, jobs...)
+	if err != nil {
+		return fmt.Errorf("daemon: %w", err)
+	}
+
+	return sched.Run(ctx)
+}
+
+func setupCommand(args []string) error {
+	fs := newFlagSet("setup", "Encrypt a Google OAuth client file into the credential store and authorize Gmail access, or store a service account key.")
+	credPath := fs.String("credentials-file", os.Getenv("GOOGLE_CREDENTIALS_FILE"), "path to the Google OAuth credentials JSON (GOOGLE_CREDENTIALS_FILE)")
+	saPath := fs.String("service-account-file", os.Getenv("GOOGLE_SERVICE_ACCOUNT_FILE"), "path to a service account key JSON for domain-wide delegation (GOOGLE_SERVICE_ACCOUNT_FILE)")
+	headless := fs.Bool("headless", false, "authorize from a browser on another machine by pasting the redirect URL")
+	timeout := fs.Duration("auth-timeout", credentials.DefaultAuthTimeout, "how long to wait for the authorization")
+	readOnly := fs.Bool("read-only", false, "grant only read access, enough for preview and dry runs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := resolvePassphrase(); err != nil {
+		return err
+	}
+
+	// An explicit flag wins over the environment variable of the other one
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	switch {
+	case set["credentials-file"] && set["service-account-file"]:
+		return errors.New("use either --credentials-file or --service-account-file, not both")
+	case set["credentials-file"]:
+		*saPath = ""
+	case !set["service-account-file"] && *credPath != "" && *saPath != "":
+		return errors.New("both GOOGLE_CREDENTIALS_FILE and GOOGLE_SERVICE_ACCOUNT_FILE are set; pass --credentials-file or --service-account-file to choose")
+	}
+
+	if *saPath != "" {
+		if err := setupServiceAccount(*saPath); err != nil {
+			return fmt.Errorf("setup failed: %w", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := setupContext()
+	defer cancel()
+
+	auth := credentials.AuthOptions{Headless: *headless, Timeout: *timeout}
+	access := gmail.FullAccess
+	if *readOnly {
+		access = gmail.Access{}
+	}
+	if err := setupCredentials(ctx, *credPath, auth, access); err != nil {
+		return fmt.Errorf("setup failed: %w", err)
+	}
+	return nil
+}
+
+func historyCommand(args []string) error {
+	fs := newFlagSet("history", "List past runs recorded in the run ledger, newest first.")
+	limit := fs.Int("limit", 20, "number of runs to show (0 for all)")
+	cfg, _, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// Read-only, so that history works while a run or the daemon records runs
+	runLedger, err := ledger.OpenReadOnly(cfg.StateDir)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No runs recorded yet.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer runLedger.Close()
+
+	runs, err := runLedger.History(*limit)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs recorded yet.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tPROFILE\tSTARTED\tSTATUS\tEMAILS\tRECIPIENT\tDIGEST\tERROR")
+	for _, r := range runs {
+		hash := r.DigestHash
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		profile := r.Profile
+		if profile == "" {
+			profile = config.DefaultProfile
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			r.ID, profile, r.StartedAt.Local().Format("2006-01-02 15:04"), r.Status, len(r.MessageIDs), r.Recipient, hash, r.Error)
+	}
+	return tw.Flush()
+}
+
+// configFlag returns the value of the --config flag in args, if any
+func configFlag(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func credentialsCommand(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "rotate":
+			return credentialsRotate(args[1:])
+		case "export":
+			return credentialsExport(args[1:])
+		case "import":
+			return credentialsImport(args[1:])
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Usage: newsletterdigest_go credentials rotate | export FILE | import FILE")
+	return errors.New("unknown or missing credentials subcommand")
+}
+
+func credentialsRotate(args []string) error {
+	fs := newFlagSet("credentials rotate", "Re-encrypt the credential store with the passphrase in\nCREDENTIALS_NEW_PASSPHRASE (or _FILE or _COMMAND). Every file must decrypt\nwith CREDENTIALS_PASSPHRASE, or nothing is changed.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := resolvePassphrase(); err != nil {
+		return err
+	}
+
+	newPassphrase, err := config.ResolveSecret(context.Background(), "CREDENTIALS_NEW_PASSPHRASE")
+	if err != nil {
+		return err
+	}
+	if newPassphrase == "" {
+		return errors.New("set CREDENTIALS_NEW_PASSPHRASE (or _FILE or _COMMAND) to the new passphrase")
+	}
+
+	store, err := credentials.NewStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := store.Rotate(newPassphrase); err != nil {
+		return fmt.Errorf("rotate failed: %w", err)
+	}
+
+	fmt.Println("Credential store re-encrypted with the new passphrase.")
+	fmt.Println("Set CREDENTIALS_PASSPHRASE to it and unset CREDENTIALS_NEW_PASSPHRASE.")
+	return nil
+}
+
+const bundlePassphraseHelp = "The bundle is encrypted with CREDENTIALS_BUNDLE_PASSPHRASE (or _FILE or\n_COMMAND), or else with CREDENTIALS_PASSPHRASE."
+
+// bundlePassphrase returns the passphrase protecting exported bundles
+func bundlePassphrase() (string, error) {
+	p, err := config.ResolveSecret(context.Background(), "CREDENTIALS_BUNDLE_PASSPHRASE")
+	if err != nil || p != "" {
+		return p, err
+	}
+	return config.Secret("CREDENTIALS_PASSPHRASE"), nil
+}
+
+func credentialsExport(args []string) error {
+	fs := newFlagSet("credentials export", "Write the Google credentials, the OAuth token and the stored secrets to a\nsingle encrypted bundle FILE, to restore them elsewhere with 'credentials\nimport'. "+bundlePassphraseHelp)
+	force := fs.Bool("force", false, "overwrite FILE if it exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := resolvePassphrase(); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: newsletterdigest_go credentials export [--force] FILE")
+	}
+
+	passphrase, err := bundlePassphrase()
+	if err != nil {
+		return err
+	}
+	store, err := credentials.NewStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	data, err := store.Export(passphrase)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(fs.Arg(0), flags, 0600)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("export failed: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+
+	fmt.Printf("Credential store exported to %s.\n", fs.Arg(0))
+	return nil
+}
+
+func credentialsImport(args []string) error {
+	fs := newFlagSet("credentials import", "Restore a bundle written by 'credentials export' into the credential store,\nencrypted with CREDENTIALS_PASSPHRASE. "+bundlePassphraseHelp)
+	force := fs.Bool("force", false, "replace an existing credential store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := resolvePassphrase(); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: newsletterdigest_go credentials import [--force] FILE")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+	passphrase, err := bundlePassphrase()
+	if err != nil {
+		return err
+	}
+	bundle, err := credentials.OpenBundle(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+	store, err := credentials.NewStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := store.Import(bundle, *force); err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	contents := "credentials"
+	if bundle.Token != nil {
+		contents += ", OAuth token"
+	}
+	if n := len(bundle.Secrets); n > 0 {
+		contents += fmt.Sprintf(", %d stored secret(s)", n)
+	}
+	fmt.Printf("Imported %s from the bundle created on %s at %s.\n", contents, bundle.Host, bundle.CreatedAt.Local().Format(time.DateTime))
+	if bundle.Token == nil {
+		fmt.Println("The bundle holds no OAuth token; run setup to authorize Gmail access.")
+	}
+	return nil
+}
+
+func secretsCommand(args []string) error {
+	usage := func() error {
+		fmt.Fprintln(os.Stderr, "Usage: newsletterdigest_go secrets set NAME | get NAME | list | delete NAME")
+		return errors.New("unknown or missing secrets subcommand")
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	sub := args[0]
+	descs := map[string]string{
+		"set":    "Store the secret NAME, read from the first line of standard input, encrypted\nin the credential store. Environment variables take precedence over it.",
+		"get":    "Print the stored secret NAME.",
+		"list":   "List the stored secrets and whether the environment overrides them.",
+		"delete": "Remove the stored secret NAME.",
+	}
+	desc, ok := descs[sub]
+	if !ok {
+		return usage()
+	}
+	fs := newFlagSet("secrets "+sub, desc)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := resolvePassphrase(); err != nil {
+		return err
+	}
+	wantArgs := 1
+	if sub == "list" {
+		wantArgs = 0
+	}
+	if fs.NArg() != wantArgs {
+		return usage()
+	}
+	name := fs.Arg(0)
+
+	store, err := credentials.NewStoreFromEnv()
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "set":
+		value, err := readSecretValue(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if err := store.SetSecret(name, value); err != nil {
+			return err
+		}
+		fmt.Printf("Stored %s.\n", name)
+
+	case "get":
+		value, err := store.GetSecret(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+
+	case "list":
+		stored, err := store.Secrets()
+		if err != nil {
+			return err
+		}
+		config.FillSecrets(stored, credentials.SecretsSource)
+		names := slices.Sorted(maps.Keys(stored))
+		if len(names) == 0 {
+			fmt.Println("No secrets stored.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tIN EFFECT")
+		for _, name := range names {
+			effect := "yes"
+			switch source := config.SecretSource(name); source {
+			case credentials.SecretsSource:
+			case "":
+				effect = "no, not used by the digest"
+			default:
+				effect = "no, " + source + " takes precedence"
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", name, effect)
+		}
+		return tw.Flush()
+
+	case "delete":
+		if err := store.DeleteSecret(name); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s.\n", name)
+	}
+	return nil
+}
+
+// readSecretValue reads a secret from the first line of r, so that it stays
+// out of the shell history and the process list
+func readSecretValue(r io.Reader) (string, error) {
+	if f, ok := r.(*os.File); ok {
+		if st, err := f.Stat(); err == nil && st.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprint(os.Stderr, "Value: ")
+		}
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		return "", errors.New("no secret on standard input")
+	}
+	return value, nil
+}
+
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "Usage: newsletterdigest_go config print [flags]")
+		return errors.New("unknown or missing config subcommand")
+	}
+
+	fs := newFlagSet("config print", "Print the effective configuration merged from the config file, the environment\nand the flags. Secrets are redacted; only where each one is set is shown.")
+	cfg, _, err := loadConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	// Read the credential store to tell which secrets it provides; a store
+	// that cannot be read only leaves them reported as not set
+	err = resolvePassphrase()
+	if err == nil {
+		err = loadStoredSecrets()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: stored secrets not read: %v\n", err)
+	}
+	return cfg.WriteYAML(os.Stdout)
+}
+
+func promptsCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: newsletterdigest_go prompts check [flags]")
+		return errors.New("unknown or missing prompts subcommand")
+	}
+
+	fs := newFlagSet("prompts check", "Render every prompt template of every profile against sample data, to catch\ntemplate errors before a run.")
+	var names []string
+	fs.Func("profile", "comma-separated profiles to check (default all)", setList(&names))
+	show := fs.Bool("show", false, "print the rendered prompts")
+	cfg, _, err := loadConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("config validation: %w", err)
+	}
+	profileCfgs, err := cfg.SelectProfiles(names)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tPROFILE\tPROMPT\tSOURCE")
+	var problems, rendered []string
+	for _, pc := range profileCfgs {
+		set, err := prompts.Load(pc.PromptsDir)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", checkFail, pc.Profile, "all", pc.PromptsDir)
+			problems = append(problems, fmt.Sprintf("%s: %v", pc.Profile, err))
+			continue
+		}
+
+		common := prompts.Common{Audience: pc.Audience, Sections: pc.DigestSections()}
+		for _, k := range prompts.Kinds {
+			systemSrc, userSrc := set.Source(k)
+			source := systemSrc + ", " + userSrc
+			system, user, err := set.Render(k, prompts.Sample(k, common))
+			if err != nil {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", checkFail, pc.Profile, k, source)
+				problems = append(problems, fmt.Sprintf("%s %s: %v", pc.Profile, k, err))
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", checkPass, pc.Profile, k, source)
+			rendered = append(rendered, fmt.Sprintf("=== %s %s ===\n[system]\n%s\n\n[user]\n%s\n", pc.Profile, k, system, user))
+		}
+	}
+	tw.Flush()
+
+	if *show && len(rendered) > 0 {
+		fmt.Println()
+		fmt.Print(strings.Join(rendered, "\n"))
+	}
+	if len(problems) > 0 {
+		fmt.Println("\nProblems:")
+		fmt.Println(strings.Join(problems, "\n"))
+		return errors.New("prompt templates failed the check")
+	}
+	return nil
+}
+
+// setList returns a flag function storing a comma-separated list in dst
+func setList(dst *[]string) func(string) error {
+	return func(v string) error {
+		*dst = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+		return nil
+	}
+}
+
+func versionCommand(args []string) error {
+	fs := newFlagSet("version", "Print the version.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fmt.Printf("newsletterdigest_go %s\n", version)
+	return nil
+}
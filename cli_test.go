@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"version", []string{"version"}, ""},
+		{"help", []string{"help"}, ""},
+		{"command help", []string{"version", "-h"}, ""},
+		{"unknown command", []string{"bogus"}, `unknown command "bogus"`},
+		{"missing subcommand", []string{"config"}, "unknown or missing config subcommand"},
+		// Without a command name, the flags are those of run
+		{"default command", []string{"--no-such-flag"}, "flag provided but not defined: -no-such-flag"},
+	}
+	for _, tt := range tests {
+		err := dispatch(tt.args)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: dispatch failed: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: dispatch error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"--config", "a.yaml"}, "a.yaml"},
+		{[]string{"-config=b.yaml", "--dry-run"}, "b.yaml"},
+		{[]string{"--dry-run", "--config=c.yaml"}, "c.yaml"},
+		{[]string{"--configuration", "x"}, ""},
+		{[]string{"--", "--config", "d.yaml"}, ""},
+		{[]string{"--config"}, ""},
+	}
+	for _, tt := range tests {
+		if got := configFlag(tt.args); got != tt.want {
+			t.Errorf("configFlag(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "to_email: file@example.com\ngmail_query: label:file\nretry_max: 2\nper_email_sleep: 2s\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("TO_EMAIL", "")
+	t.Setenv("GMAIL_QUERY", "label:env")
+	t.Setenv("RETRY_MAX", "3")
+	t.Setenv("PER_EMAIL_SLEEP", "")
+
+	cfg, _, err := loadConfig(newFlagSet("run", ""), []string{"--config", path, "--retry-max", "4"})
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+
+	tests := []struct {
+		setting string
+		got     any
+		want    any
+	}{
+		{"file only", cfg.ToEmail, "file@example.com"},
+		{"file only", cfg.PerEmailSleep, 2 * time.Second},
+		{"environment over file", cfg.GmailQuery, "label:env"},
+		{"flag over environment and file", cfg.RetryMax, 4},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+}
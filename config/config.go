@@ -1,85 +1,271 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/mail"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
 
 const (
 	GmailQueryDefault = `label:newsletter is:unread`
-	MaxResults        = 80
-	PerEmailMaxChars  = 6000
-	PerEmailSleep     = 1100 * time.Millisecond
-	RetryMax          = 5
-	BackoffMin        = 1500 * time.Millisecond
-	BackoffMax        = 6 * time.Second
+
+	// Values of GmailAuth
+	GmailAuthOAuth          = "oauth"           // the OAuth token authorized by setup
+	GmailAuthServiceAccount = "service_account" // a service account with domain-wide delegation
+
+	// Defaults of the Tunables
+	MaxResults         = 80
+	PerEmailMaxChars   = 6000
+	PerEmailSleep      = 1100 * time.Millisecond
+	RetryMax           = 5
+	BackoffMin         = 1500 * time.Millisecond
+	BackoffMax         = 6 * time.Second
+	LinkedInFetchPosts = 15 // more than kept, to account for filtering
+	LinkedInMaxPosts   = 10
+	MinTextChars       = 400
+	ArticleMaxChars    = 8000
+	LinkedInMaxAge     = 7 * 24 * time.Hour
 )
 
+// Config is the effective configuration. Its yaml keys are the keys of the
+// config file.
 type Config struct {
-	GmailQuery                string
-	MaxResults                int64
-	ToEmail                   string
-	SmallModel                string
-	FinalModel                string
-	DryRun                    bool
-	AppendSample              bool
-	ShowFooter                bool
-	FetchFullContent          bool
-	FetchLinkedInHashtags     bool
-	LinkedInFetchFullContent  bool
-	LinkedInFilterPromotional bool
-	LinkedInOnlyMode          bool
-	LinkedInHashtags          []string
-	PerEmailMaxChars          int
-	PerEmailSleep             time.Duration
-	PromptSingle              string
-	PromptFinal               string
+	GmailQuery                string       `yaml:"gmail_query"`
+	GmailAuth                 string       `yaml:"gmail_auth"`    // oauth or service_account
+	GmailSubject              string       `yaml:"gmail_subject"` // mailbox a service account impersonates
+	ToEmail                   string       `yaml:"to_email"`
+	SmallModel                string       `yaml:"model_small"`
+	FinalModel                string       `yaml:"model_final"`
+	DryRun                    bool         `yaml:"dry_run"`
+	DryRunNoCache             bool         `yaml:"dry_run_no_cache"`
+	AppendSample              bool         `yaml:"append_sample"`
+	ShowFooter                bool         `yaml:"show_footer"`
+	FetchFullContent          bool         `yaml:"fetch_full_content"`
+	FetchLinkedInHashtags     bool         `yaml:"fetch_linkedin_hashtags"`
+	LinkedInFetchFullContent  bool         `yaml:"linkedin_fetch_full_content"`
+	LinkedInFilterPromotional bool         `yaml:"linkedin_filter_promotional"`
+	LinkedInOnlyMode          bool         `yaml:"linkedin_only_mode"`
+	LinkedInHashtags          []string     `yaml:"linkedin_hashtags"`
+	PromptSingle              string       `yaml:"prompt_single_summary"`  // replaces the single summary system template
+	PromptFinal               string       `yaml:"prompt_final_synthesis"` // replaces the final synthesis system template
+	PromptsDir                string       `yaml:"prompts_dir"`            // directory of prompt templates replacing the embedded ones
+	Audience                  string       `yaml:"audience"`               // who the digest is written for, given to the prompts
+	Schedule                  string       `yaml:"schedule"`               // cron expression used by the daemon
+	CatchUpMissed             bool         `yaml:"schedule_catch_up"`      // daemon runs a missed schedule once on wake-up
+	StateDir                  string       `yaml:"state_dir"`              // local state such as the daemon's last run times
+	LogLevel                  string       `yaml:"log_level"`              // debug, info, warn or error
+	LogFormat                 string       `yaml:"log_format"`             // text or json
+	Sections                  []Section    `yaml:"sections"`               // digest sections in priority order
+	Senders                   []SenderRule `yaml:"senders"`                // per-sender rules, first match applies
+	Profile                   string       `yaml:"-"`                      // name of the profile this configuration is for
+	Tunables                  `yaml:",inline"`
+	Profiles                  []Profile `yaml:"profiles,omitempty"`
+
+	flags *flag.FlagSet `yaml:"-"` // command-line flags bound by BindFlags
 }
 
-func Load() *Config {
-	// Load .env file (optional, environment variables take precedence)
-	LoadEnvFile(".env")
+// Default returns the configuration used when nothing is configured
+func Default() *Config {
+	return &Config{
+		GmailQuery:                GmailQueryDefault,
+		GmailAuth:                 GmailAuthOAuth,
+		SmallModel:                "claude-haiku-4-5-20251001",
+		FinalModel:                "claude-sonnet-4-5-20250929",
+		AppendSample:              true,
+		ShowFooter:                true,
+		FetchFullContent:          true,
+		FetchLinkedInHashtags:     true,
+		LinkedInFetchFullContent:  true,
+		LinkedInFilterPromotional: true,
+		LinkedInOnlyMode:          true,
+		LinkedInHashtags:          []string{"ehealth", "healthcare", "architecture", "productmanagement", "teamorganization"},
+		Audience:                  "a product executive",
+		StateDir:                  defaultStateDir(),
+		LogLevel:                  "info",
+		LogFormat:                 "text",
+		Sections:                  slices.Clone(DefaultSections),
+		Profile:                   DefaultProfile,
+		Tunables:                  DefaultTunables(),
+	}
+}
 
-	// Default prompts
-	defaultSinglePrompt := "You summarize single newsletters for a product executive. Return 3–6 short bullets as plain text lines (no HTML/Markdown). Priorities: 1) Product Management 2) Healthcare 3) Software Architecture & Technology 4) Team Organization. Focus on software/system architecture, not building architecture. Compress or omit pure AI hype unless it clearly impacts those four. No fluff."
+// Load builds the configuration from the defaults, the config file at path
+// and the environment, each overriding the one before. Without a path,
+// CONFIG_FILE or else DefaultFile is read if it exists. Every problem found
+// is returned at once, together with the configuration loaded despite them.
+func Load(path string) (*Config, error) {
+	c := Default()
+	var errs []error
 
-	defaultFinalPrompt := "You assemble a concise weekly digest for a product executive combining newsletter content and LinkedIn insights. Priorities: 1) Product Management 2) Healthcare 3) Software Architecture & Technology 4) Team Organization 5) AI. ALWAYS generate ALL 5 sections in this exact order, even if some sections are brief. For Architecture section: focus ONLY on software architecture, system design, cloud architecture, microservices, APIs, technical architecture - NOT building or physical architecture. Merge content from both newsletters and LinkedIn posts into each relevant section. OUTPUT ONLY PLAIN TEXT organized by sections. Use section headers like '=== Product Management ===' followed by bullet points as plain text lines starting with '- '. When you see [L1], [L2], etc., keep them as-is in the text for later link replacement. Do not use any HTML tags, Markdown, or special formatting. Just plain text with section headers and bullet points. Generate all sections consistently."
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		if _, err := os.Stat(DefaultFile); err == nil {
+			path = DefaultFile
+		}
+	}
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-	// Parse LinkedIn hashtags
-	hashtagsStr := getenv("LINKEDIN_HASHTAGS", "ehealth,healthcare,architecture,productmanagement,teamorganization")
-	var hashtags []string
-	if hashtagsStr != "" {
-		for _, tag := range strings.Split(hashtagsStr, ",") {
-			hashtags = append(hashtags, strings.TrimSpace(tag))
+	if err := c.applyEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	return c, errors.Join(errs...)
+}
+
+// isBoolean reports whether v is a boolean setting, which the config file and
+// the environment both write as true or false
+func isBoolean(v string) bool {
+	return v == "true" || v == "false"
+}
+
+// applyEnv overrides the configuration with the environment variables that
+// are set
+func (c *Config) applyEnv() error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v := os.Getenv(key); v != "" {
+			if !isBoolean(v) {
+				errs = append(errs, fmt.Errorf("%s: invalid boolean %q (want true or false)", key, v))
+				return
+			}
+			*dst = v == "true"
+		}
+	}
+	list := func(key string, dst *[]string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = splitList(v)
 		}
 	}
 
-	return &Config{
-		GmailQuery:                getenv("GMAIL_QUERY", GmailQueryDefault),
-		MaxResults:                MaxResults,
-		ToEmail:                   os.Getenv("TO_EMAIL"),
-		SmallModel:                getenv("CLAUDE_MODEL_SMALL", "claude-haiku-4-5-20251001"),
-		FinalModel:                getenv("CLAUDE_MODEL_FINAL", "claude-sonnet-4-5-20250929"),
-		DryRun:                    strings.ToLower(getenv("DRY_RUN", "false")) == "true",
-		AppendSample:              strings.ToLower(getenv("APPEND_SAMPLE", "true")) == "true",
-		ShowFooter:                strings.ToLower(getenv("SHOW_FOOTER", "true")) == "true",
-		FetchFullContent:          strings.ToLower(getenv("FETCH_FULL_CONTENT", "true")) == "true",
-		FetchLinkedInHashtags:     strings.ToLower(getenv("FETCH_LINKEDIN_HASHTAGS", "true")) == "true",
-		LinkedInFetchFullContent:  strings.ToLower(getenv("LINKEDIN_FETCH_FULL_CONTENT", "true")) == "true",
-		LinkedInFilterPromotional: strings.ToLower(getenv("LINKEDIN_FILTER_PROMOTIONAL", "true")) == "true",
-		LinkedInOnlyMode:          strings.ToLower(getenv("LINKEDIN_ONLY_MODE", "true")) == "true",
-		LinkedInHashtags:          hashtags,
-		PerEmailMaxChars:          PerEmailMaxChars,
-		PerEmailSleep:             PerEmailSleep,
-		PromptSingle:              getenv("PROMPT_SINGLE_SUMMARY", defaultSinglePrompt),
-		PromptFinal:               getenv("PROMPT_FINAL_SYNTHESIS", defaultFinalPrompt),
+	str("GMAIL_QUERY", &c.GmailQuery)
+	str("GMAIL_AUTH", &c.GmailAuth)
+	str("GMAIL_SUBJECT", &c.GmailSubject)
+	str("TO_EMAIL", &c.ToEmail)
+	str("CLAUDE_MODEL_SMALL", &c.SmallModel)
+	str("CLAUDE_MODEL_FINAL", &c.FinalModel)
+	boolean("DRY_RUN", &c.DryRun)
+	boolean("DRY_RUN_NO_CACHE", &c.DryRunNoCache)
+	boolean("APPEND_SAMPLE", &c.AppendSample)
+	boolean("SHOW_FOOTER", &c.ShowFooter)
+	boolean("FETCH_FULL_CONTENT", &c.FetchFullContent)
+	boolean("FETCH_LINKEDIN_HASHTAGS", &c.FetchLinkedInHashtags)
+	boolean("LINKEDIN_FETCH_FULL_CONTENT", &c.LinkedInFetchFullContent)
+	boolean("LINKEDIN_FILTER_PROMOTIONAL", &c.LinkedInFilterPromotional)
+	boolean("LINKEDIN_ONLY_MODE", &c.LinkedInOnlyMode)
+	list("LINKEDIN_HASHTAGS", &c.LinkedInHashtags)
+	str("PROMPT_SINGLE_SUMMARY", &c.PromptSingle)
+	str("PROMPT_FINAL_SYNTHESIS", &c.PromptFinal)
+	str("PROMPTS_DIR", &c.PromptsDir)
+	str("AUDIENCE", &c.Audience)
+	str("SCHEDULE", &c.Schedule)
+	boolean("SCHEDULE_CATCH_UP", &c.CatchUpMissed)
+	str("STATE_DIR", &c.StateDir)
+	str("LOG_LEVEL", &c.LogLevel)
+	str("LOG_FORMAT", &c.LogFormat)
+	if v := os.Getenv("SECTIONS"); v != "" {
+		c.Sections = sectionsNamed(splitList(v))
+	}
+	if err := c.Tunables.applyEnv(""); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.applyProfileEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the configuration of every profile and reports all
+// problems at once
+func (c *Config) Validate() error {
+	return errors.Join(c.validateGmailAuth(), c.validateProfiles())
+}
+
+// validateGmailAuth checks the mailbox authentication, which all profiles
+// share
+func (c *Config) validateGmailAuth() error {
+	switch c.GmailAuth {
+	case GmailAuthOAuth, "":
+		if c.GmailSubject != "" {
+			return fmt.Errorf("gmail subject %q needs gmail auth %s (GMAIL_AUTH)", c.GmailSubject, GmailAuthServiceAccount)
+		}
+	case GmailAuthServiceAccount:
+		if c.GmailSubject == "" {
+			return errors.New("gmail auth service_account needs the mailbox to impersonate (GMAIL_SUBJECT or --gmail-subject)")
+		}
+		if _, err := mail.ParseAddress(c.GmailSubject); err != nil {
+			return fmt.Errorf("invalid gmail subject %q: %w", c.GmailSubject, err)
+		}
+	default:
+		return fmt.Errorf("invalid gmail auth %q (want %s or %s)", c.GmailAuth, GmailAuthOAuth, GmailAuthServiceAccount)
+	}
+	return nil
+}
+
+// validateShared checks the settings every profile shares
+func (c *Config) validateShared() error {
+	var errs []error
+	if c.SmallModel == "" || c.FinalModel == "" {
+		errs = append(errs, errors.New("Claude model names must not be empty"))
+	}
+	if !slices.Contains([]string{"debug", "info", "warn", "error"}, strings.ToLower(c.LogLevel)) {
+		errs = append(errs, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", c.LogLevel))
+	}
+	if f := strings.ToLower(c.LogFormat); f != "text" && f != "json" {
+		errs = append(errs, fmt.Errorf("invalid log format %q (want text or json)", c.LogFormat))
+	}
+	return errors.Join(errs...)
+}
+
+// validateFields checks the settings a profile can override
+func (c *Config) validateFields() error {
+	var errs []error
+	if c.ToEmail == "" {
+		errs = append(errs, errors.New("recipient not set (TO_EMAIL or --to-email)"))
+	} else if _, err := mail.ParseAddressList(c.ToEmail); err != nil {
+		// TO_EMAIL may list several comma-separated recipients
+		errs = append(errs, fmt.Errorf("invalid recipient %q: %w", c.ToEmail, err))
+	}
+	if err := c.Tunables.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if strings.TrimSpace(c.Audience) == "" {
+		errs = append(errs, errors.New("audience must not be empty"))
+	}
+	if slices.Contains(c.LinkedInHashtags, "") {
+		errs = append(errs, fmt.Errorf("empty entry in LinkedIn hashtags %q", strings.Join(c.LinkedInHashtags, ",")))
+	}
+	if err := validateSections(c.Sections); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateSenderRules(c.Senders, c.Sections); err != nil {
+		errs = append(errs, err)
 	}
+	return errors.Join(errs...)
 }
 
-func getenv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// defaultStateDir returns ~/.newsletterdigest, or a relative directory when
+// the home directory is unknown
+func defaultStateDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".newsletterdigest"
 	}
-	return def
+	return filepath.Join(homeDir, ".newsletterdigest")
 }
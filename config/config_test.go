@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestValidateGmailAuth(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		auth, subject string
+		wantErr       bool
+	}{
+		{"default", "", "", false},
+		{"oauth", GmailAuthOAuth, "", false},
+		{"service account", GmailAuthServiceAccount, "me@example.com", false},
+		{"service account without subject", GmailAuthServiceAccount, "", true},
+		{"invalid subject", GmailAuthServiceAccount, "not an address", true},
+		{"subject with oauth", GmailAuthOAuth, "me@example.com", true},
+		{"unknown mode", "password", "", true},
+	} {
+		cfg := &Config{GmailAuth: tt.auth, GmailSubject: tt.subject}
+		if err := cfg.validateGmailAuth(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateGmailAuth error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -1,15 +1,20 @@
 package config
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 )
 
-// LoadEnvFile loads environment variables from a .env file
+var envKeyRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// LoadEnvFile loads environment variables from a .env file. Variables already
+// set in the environment take precedence. Malformed entries are reported by
+// line; the valid entries are loaded regardless.
 func LoadEnvFile(filename string) error {
-	file, err := os.Open(filename)
+	data, err := os.ReadFile(filename)
 	if err != nil {
 		// .env file is optional, so don't fail if it doesn't exist
 		if os.IsNotExist(err) {
@@ -17,31 +22,205 @@ func LoadEnvFile(filename string) error {
 		}
 		return fmt.Errorf("error opening .env file: %w", err)
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	vars, err := parseEnv(string(data))
+	for key, value := range vars {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// parseEnv parses the content of a .env file:
+//
+//	KEY=value               # inline comments follow whitespace
+//	export KEY=value        # the export prefix is ignored
+//	KEY="a\tb\n${OTHER}"    # escapes and interpolation
+//	KEY=pa$$word            # unquoted values are taken literally
+//	KEY='literal ${OTHER}'  # no escapes, no interpolation
+//	KEY="first line
+//	second line"            # quoted values may span lines
+//
+// Only ${VAR} in double quotes is expanded, to the environment variable, or
+// else to an earlier entry of the file, or else to nothing; a $ not followed
+// by { is kept as is.
+func parseEnv(data string) (map[string]string, error) {
+	p := &envParser{data: data, line: 1, vars: make(map[string]string)}
+	for p.pos < len(p.data) {
+		p.entry()
+	}
+	return p.vars, errors.Join(p.errs...)
+}
+
+type envParser struct {
+	data string
+	pos  int
+	line int
+	vars map[string]string
+	errs []error
+}
+
+// entry parses one line, or one multi-line quoted entry
+func (p *envParser) entry() {
+	start := p.line
+	line := strings.TrimSpace(p.restOfLine())
+	if line == "" || strings.HasPrefix(line, "#") {
+		p.nextLine()
+		return
+	}
+
+	if rest, ok := strings.CutPrefix(line, "export"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+		line = rest
+	}
+	key, _, ok := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !ok {
+		p.fail(start, "missing '=' in %q", line)
+		return
+	}
+	if !envKeyRE.MatchString(key) {
+		p.fail(start, "invalid variable name %q", key)
+		return
+	}
+
+	// Continue parsing the value from its first character
+	p.pos += strings.Index(p.restOfLine(), "=") + 1
+	p.skipBlanks()
+
+	var v string
+	var err error
+	switch {
+	case p.peek() == '"':
+		v, err = p.quoted('"')
+	case p.peek() == '\'':
+		v, err = p.quoted('\'')
+	default:
+		v = p.unquoted()
+	}
+	if err != nil {
+		p.fail(start, "%s: %v", key, err)
+		return
+	}
+	p.vars[key] = v
+	p.nextLine()
+}
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// quoted parses a value in quotes, which may span lines. Double-quoted values
+// understand escapes and interpolation.
+func (p *envParser) quoted(q byte) (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == q:
+			p.pos++
+			p.skipBlanks()
+			if rest := p.restOfLine(); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected %q after closing quote", rest)
+			}
+			return b.String(), nil
+		case c == '\\' && q == '"' && p.pos+1 < len(p.data):
+			p.pos++
+			switch e := p.data[p.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			default:
+				if e == '\n' {
+					p.line++
+				}
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+			p.pos++
+		case c == '$' && q == '"':
+			b.WriteString(p.variable())
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+			p.pos++
 		}
+	}
+	return "", fmt.Errorf("unterminated %c-quoted value", q)
+}
 
-		// Split on the first '=' to handle values that contain '='
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
+// unquoted parses a value up to the end of the line or an inline comment
+func (p *envParser) unquoted() string {
+	var b strings.Builder
+	for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+		c := p.data[p.pos]
+		if c == '#' && (p.pos == 0 || p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+			break
 		}
+		b.WriteByte(c)
+		p.pos++
+	}
+	return strings.TrimSpace(b.String())
+}
 
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
+// variable expands the ${VAR} at the current position. Any other $ is kept
+// as is.
+func (p *envParser) variable() string {
+	rest := p.data[p.pos+1:]
+	end := strings.IndexAny(rest, "}\n")
+	if !strings.HasPrefix(rest, "{") || end == -1 || rest[end] != '}' || !envKeyRE.MatchString(rest[1:end]) {
+		p.pos++
+		return "$"
+	}
+	name := rest[1:end]
+	p.pos += 1 + end + 1
 
-		// Only set if not already set (environment variables take precedence)
-		if os.Getenv(key) == "" {
-			os.Setenv(key, value)
-		}
+	if v := os.Getenv(name); v != "" {
+		return v
 	}
+	return p.vars[name]
+}
+
+func (p *envParser) restOfLine() string {
+	rest := p.data[p.pos:]
+	if i := strings.IndexByte(rest, '\n'); i != -1 {
+		rest = rest[:i]
+	}
+	return strings.TrimRight(rest, "\r")
+}
+
+// nextLine moves past the end of the current line
+func (p *envParser) nextLine() {
+	if i := strings.IndexByte(p.data[p.pos:], '\n'); i != -1 {
+		p.pos += i + 1
+		p.line++
+	} else {
+		p.pos = len(p.data)
+	}
+}
+
+func (p *envParser) skipBlanks() {
+	for p.pos < len(p.data) && (p.data[p.pos] == ' ' || p.data[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *envParser) peek() byte {
+	if p.pos < len(p.data) {
+		return p.data[p.pos]
+	}
+	return 0
+}
 
-	return scanner.Err()
+// fail records a malformed entry and skips the rest of its line
+func (p *envParser) fail(line int, format string, args ...any) {
+	p.errs = append(p.errs, fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...)))
+	p.nextLine()
 }
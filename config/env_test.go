@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	t.Setenv("ENV_TEST_HOME", "/home/me")
+
+	vars, err := parseEnv(`# comment
+PLAIN=value
+SPACED = spaced value   # inline comment
+HASH=a#b
+export EXPORTED=yes
+export	TABBED=yes
+exported=no
+DOUBLE="say \"hi\"\tnow\n"
+SINGLE='keep $ENV_TEST_HOME and \n'
+EMPTY=
+INTERP="${ENV_TEST_HOME}/state"
+CHAINED="$PLAIN-${SPACED}"
+UNQUOTED=pa$$word ${PLAIN}
+ESCAPED="\${PLAIN} costs \$5"
+MULTI="first line
+second line" # trailing comment
+MULTI_SINGLE='a
+b'
+`)
+	if err != nil {
+		t.Fatalf("parseEnv failed: %v", err)
+	}
+
+	want := map[string]string{
+		"PLAIN":        "value",
+		"SPACED":       "spaced value",
+		"HASH":         "a#b",
+		"EXPORTED":     "yes",
+		"TABBED":       "yes",
+		"exported":     "no",
+		"DOUBLE":       "say \"hi\"\tnow\n",
+		"SINGLE":       `keep $ENV_TEST_HOME and \n`,
+		"EMPTY":        "",
+		"INTERP":       "/home/me/state",
+		"CHAINED":      "$PLAIN-spaced value",
+		"UNQUOTED":     "pa$$word ${PLAIN}",
+		"ESCAPED":      "${PLAIN} costs $5",
+		"MULTI":        "first line\nsecond line",
+		"MULTI_SINGLE": "a\nb",
+	}
+	for key, v := range want {
+		if got, ok := vars[key]; !ok || got != v {
+			t.Errorf("%s = %q, want %q", key, got, v)
+		}
+	}
+	if len(vars) != len(want) {
+		t.Errorf("Expected %d variables, got %v", len(want), vars)
+	}
+}
+
+func TestParseEnvReportsMalformedLines(t *testing.T) {
+	vars, err := parseEnv(`GOOD=1
+no equals sign
+BAD KEY=2
+QUOTE="closed" trailing
+AFTER=3
+ESCAPED="escaped \
+newline"
+OPEN="never closed
+`)
+	if err == nil {
+		t.Fatal("Expected parseEnv to fail")
+	}
+	for _, want := range []string{"line 2: missing '='", "line 3: invalid variable name", "line 4: QUOTE: unexpected", "line 8: OPEN: unterminated"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected problem %q, got:\n%v", want, err)
+		}
+	}
+	if vars["GOOD"] != "1" || vars["AFTER"] != "3" || vars["ESCAPED"] != "escaped \\\nnewline" {
+		t.Errorf("Expected valid entries to be kept, got %v", vars)
+	}
+}
+
+func TestLoadEnvFileKeepsEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("ENV_TEST_SET=file\nENV_TEST_UNSET=file\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	t.Setenv("ENV_TEST_SET", "environment")
+	t.Setenv("ENV_TEST_UNSET", "")
+
+	if err := LoadEnvFile(path); err != nil {
+		t.Fatalf("LoadEnvFile failed: %v", err)
+	}
+	if got := os.Getenv("ENV_TEST_SET"); got != "environment" {
+		t.Errorf("Expected the environment to take precedence, got %q", got)
+	}
+	if got := os.Getenv("ENV_TEST_UNSET"); got != "file" {
+		t.Errorf("Expected the file to fill unset variables, got %q", got)
+	}
+}
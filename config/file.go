@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the config file read from the working directory when no
+// other file is given
+const DefaultFile = "newsletterdigest.yaml"
+
+// loadFile applies the settings of a YAML config file. Unknown keys and values
+// of the wrong type are errors; all of them are reported together.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	var errs []error
+	boolErrs := invalidBooleans(doc.Content[0])
+	for _, line := range slices.Sorted(maps.Keys(boolErrs)) {
+		errs = append(errs, fmt.Errorf("%s: %s", path, boolErrs[line]))
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		for _, msg := range typeErr.Errors {
+			// Invalid booleans were already reported with their key
+			var line int
+			fmt.Sscanf(msg, "line %d:", &line)
+			if _, dup := boolErrs[line]; !dup {
+				errs = append(errs, fmt.Errorf("%s: %s", path, msg))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// invalidBooleans reports the boolean settings not written as true or false,
+// keyed by line, including those of sender rules, sections and profiles. The
+// decoder would accept yes/no/on/off and leave out the key when reporting
+// other values.
+func invalidBooleans(root *yaml.Node) map[int]string {
+	msgs := make(map[int]string)
+	checkBooleans(root, reflect.TypeOf(Config{}), msgs)
+	return msgs
+}
+
+// checkBooleans checks the booleans of a mapping node decoded into the
+// struct type t, and of the structs nested in it
+func checkBooleans(node *yaml.Node, t reflect.Type, msgs map[int]string) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	fields := yamlFields(t)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		ft, ok := fields[key.Value]
+		if !ok {
+			continue
+		}
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch {
+		case ft.Kind() == reflect.Bool:
+			if value.Kind == yaml.ScalarNode && (value.ShortTag() != "!!bool" || !isBoolean(value.Value)) {
+				msgs[value.Line] = fmt.Sprintf("line %d: %s: invalid boolean %q (want true or false)", value.Line, key.Value, value.Value)
+			}
+		case ft.Kind() == reflect.Struct:
+			checkBooleans(value, ft, msgs)
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct && value.Kind == yaml.SequenceNode:
+			for _, item := range value.Content {
+				checkBooleans(item, ft.Elem(), msgs)
+			}
+		}
+	}
+}
+
+// yamlFields maps the keys of the struct type t in a config file to the
+// types of their fields, including the fields of inline structs
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-":
+		case strings.Contains(opts, "inline"):
+			maps.Copy(fields, yamlFields(f.Type))
+		case name != "":
+			fields[name] = f.Type
+		default:
+			fields[strings.ToLower(f.Name)] = f.Type
+		}
+	}
+	return fields
+}
+
+// WriteYAML writes the configuration in config file format. Secrets are not
+// part of the configuration; a trailing comment only says where each is set.
+func (c *Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "# Secrets (values redacted):")
+	for _, key := range secretEnv {
+		state := "not set"
+		switch source := SecretSource(key); {
+		case source == "":
+		case source == key:
+			state = "from the environment"
+		case source == key+"_FILE":
+			state = "from the file in " + source
+		case source == key+"_COMMAND":
+			state = "from the command in " + source
+		default:
+			state = "from the " + source
+		}
+		if _, err := fmt.Fprintf(w, "#   %s: %s\n", key, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
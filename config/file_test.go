@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfigFile(t, `
+to_email: me@example.com
+gmail_query: label:digest is:unread
+dry_run: true
+per_email_sleep: 2s
+linkedin_hashtags: [healthcare, architecture]
+prompt_final_synthesis: |
+  You assemble a digest.
+  Keep it short.
+profiles:
+  - name: product
+    to_email: pm@example.com
+`)
+	t.Setenv("GMAIL_QUERY", "label:override")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	if cfg.ToEmail != "me@example.com" || !cfg.DryRun || cfg.PerEmailSleep != 2*time.Second {
+		t.Errorf("File settings not applied: %+v", cfg)
+	}
+	if cfg.GmailQuery != "label:override" {
+		t.Errorf("Expected the environment to override the file, got %q", cfg.GmailQuery)
+	}
+	if !strings.Contains(cfg.PromptFinal, "\nKeep it short.") {
+		t.Errorf("Expected multi-line prompt, got %q", cfg.PromptFinal)
+	}
+	if !cfg.ShowFooter {
+		t.Error("Expected settings missing from the file to keep their defaults")
+	}
+	if len(cfg.Profiles) != 1 || cfg.Profiles[0].ToEmail != "pm@example.com" {
+		t.Errorf("Unexpected profiles %+v", cfg.Profiles)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	path := writeConfigFile(t, `
+to_email: not an address
+dry_run: yes
+show_footer: maybe
+schedule_catch_up: TRUE
+linkedin_hashtags: [healthcare, "", architecture]
+unknown_key: 1
+senders:
+  - from: news@example.com
+    fetch_full_content: no
+profiles:
+  - name: product
+    sections:
+      - name: Product
+        optional: on
+`)
+	t.Setenv("APPEND_SAMPLE", "sure")
+	t.Setenv("DRY_RUN_NO_CACHE", "1")
+
+	cfg, err := Load(path)
+	if err == nil {
+		t.Fatal("Expected Load to fail")
+	}
+	all := err.Error() + "\n" + cfg.Validate().Error()
+
+	for _, want := range []string{
+		`dry_run: invalid boolean "yes"`,
+		"show_footer",
+		"unknown_key",
+		`schedule_catch_up: invalid boolean "TRUE"`,
+		`fetch_full_content: invalid boolean "no"`,
+		`optional: invalid boolean "on"`,
+		`APPEND_SAMPLE: invalid boolean "sure"`,
+		`DRY_RUN_NO_CACHE: invalid boolean "1"`,
+		"invalid recipient",
+		"empty entry in LinkedIn hashtags",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Expected problem %q to be reported, got:\n%s", want, all)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// BindFlags registers a command-line flag for every Config field.
+// Flag defaults are the values already loaded from the environment, so a flag
+// only changes the configuration when it is passed explicitly. Flags set the
+// top-level values, and ProfileConfigs sets the flags passed again over each
+// profile's settings, so that they take precedence over those too.
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	c.flags = fs
+	c.bindFlags(fs)
+}
+
+// applyFlags sets the flags passed on the command line in c again, over the
+// settings of its profile
+func (c *Config) applyFlags() {
+	if c.flags == nil {
+		return
+	}
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	c.bindFlags(fs)
+	c.flags.Visit(func(f *flag.Flag) {
+		// The flags of the command itself, such as --profile, are not settings
+		if fs.Lookup(f.Name) != nil {
+			fs.Set(f.Name, f.Value.String())
+		}
+	})
+}
+
+func (c *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.GmailQuery, "gmail-query", c.GmailQuery, "Gmail search query (GMAIL_QUERY)")
+	fs.StringVar(&c.GmailAuth, "gmail-auth", c.GmailAuth, "Gmail authentication: oauth or service_account (GMAIL_AUTH)")
+	fs.StringVar(&c.GmailSubject, "gmail-subject", c.GmailSubject, "mailbox the service account impersonates (GMAIL_SUBJECT)")
+	fs.Int64Var(&c.MaxResults, "max-results", c.MaxResults, "maximum number of messages to fetch (MAX_RESULTS)")
+	fs.StringVar(&c.ToEmail, "to-email", c.ToEmail, "digest recipient (TO_EMAIL)")
+	fs.StringVar(&c.SmallModel, "model-small", c.SmallModel, "Claude model for individual summaries (CLAUDE_MODEL_SMALL)")
+	fs.StringVar(&c.FinalModel, "model-final", c.FinalModel, "Claude model for the final digest (CLAUDE_MODEL_FINAL)")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "send nothing and modify nothing; print a simulation report instead (DRY_RUN)")
+	fs.BoolVar(&c.DryRunNoCache, "dry-run-no-cache", c.DryRunNoCache, "in dry run, also skip writing the LinkedIn API cache (DRY_RUN_NO_CACHE)")
+	fs.BoolVar(&c.AppendSample, "append-sample", c.AppendSample, "include per-email sample bullets (APPEND_SAMPLE)")
+	fs.BoolVar(&c.ShowFooter, "show-footer", c.ShowFooter, "include the content sources footer (SHOW_FOOTER)")
+	fs.BoolVar(&c.FetchFullContent, "fetch-full-content", c.FetchFullContent, "fetch full LinkedIn articles for newsletter teasers (FETCH_FULL_CONTENT)")
+	fs.BoolVar(&c.FetchLinkedInHashtags, "fetch-linkedin-hashtags", c.FetchLinkedInHashtags, "include LinkedIn hashtag posts (FETCH_LINKEDIN_HASHTAGS)")
+	fs.BoolVar(&c.LinkedInFetchFullContent, "linkedin-fetch-full-content", c.LinkedInFetchFullContent, "fetch full content for short LinkedIn posts (LINKEDIN_FETCH_FULL_CONTENT)")
+	fs.BoolVar(&c.LinkedInFilterPromotional, "linkedin-filter-promotional", c.LinkedInFilterPromotional, "drop promotional LinkedIn posts (LINKEDIN_FILTER_PROMOTIONAL)")
+	fs.BoolVar(&c.LinkedInOnlyMode, "linkedin-only", c.LinkedInOnlyMode, "build a digest even without newsletters (LINKEDIN_ONLY_MODE)")
+	fs.Var((*stringList)(&c.LinkedInHashtags), "linkedin-hashtags", "comma-separated LinkedIn hashtags (LINKEDIN_HASHTAGS)")
+	fs.IntVar(&c.PerEmailMaxChars, "per-email-max-chars", c.PerEmailMaxChars, "maximum characters of each newsletter sent for summarization (PER_EMAIL_MAX_CHARS)")
+	fs.DurationVar(&c.PerEmailSleep, "per-email-sleep", c.PerEmailSleep, "pause between newsletter summaries (PER_EMAIL_SLEEP)")
+	fs.IntVar(&c.RetryMax, "retry-max", c.RetryMax, "attempts per Claude request (RETRY_MAX)")
+	fs.DurationVar(&c.BackoffMin, "backoff-min", c.BackoffMin, "first Claude retry backoff, doubled per attempt (BACKOFF_MIN)")
+	fs.DurationVar(&c.BackoffMax, "backoff-max", c.BackoffMax, "longest Claude retry backoff (BACKOFF_MAX)")
+	fs.IntVar(&c.LinkedInFetchPosts, "linkedin-fetch-posts", c.LinkedInFetchPosts, "LinkedIn posts fetched before filtering (LINKEDIN_FETCH_POSTS)")
+	fs.IntVar(&c.LinkedInMaxPosts, "linkedin-max-posts", c.LinkedInMaxPosts, "LinkedIn posts kept for the digest (LINKEDIN_MAX_POSTS)")
+	fs.IntVar(&c.MinTextChars, "min-text-chars", c.MinTextChars, "shortest message text counted as a newsletter (MIN_TEXT_CHARS)")
+	fs.IntVar(&c.ArticleMaxChars, "article-max-chars", c.ArticleMaxChars, "characters of a full LinkedIn article kept (ARTICLE_MAX_CHARS)")
+	fs.DurationVar(&c.LinkedInMaxAge, "linkedin-max-age", c.LinkedInMaxAge, "oldest LinkedIn post included (LINKEDIN_MAX_AGE)")
+	fs.StringVar(&c.PromptSingle, "prompt-single", c.PromptSingle, "system prompt for single summaries (PROMPT_SINGLE_SUMMARY)")
+	fs.StringVar(&c.PromptFinal, "prompt-final", c.PromptFinal, "system prompt for the final synthesis (PROMPT_FINAL_SYNTHESIS)")
+	fs.StringVar(&c.PromptsDir, "prompts-dir", c.PromptsDir, "directory of prompt templates replacing the embedded ones (PROMPTS_DIR)")
+	fs.StringVar(&c.Audience, "audience", c.Audience, "who the digest is written for (AUDIENCE)")
+	fs.StringVar(&c.Schedule, "schedule", c.Schedule, "cron schedule for the daemon, e.g. \"0 7 * * MON\" (SCHEDULE)")
+	fs.BoolVar(&c.CatchUpMissed, "catch-up", c.CatchUpMissed, "run a missed daemon schedule once after wake-up (SCHEDULE_CATCH_UP)")
+	fs.StringVar(&c.StateDir, "state-dir", c.StateDir, "directory for local state (STATE_DIR)")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "log level: debug, info, warn or error (LOG_LEVEL)")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "log format: text or json (LOG_FORMAT)")
+	fs.Var((*sectionList)(&c.Sections), "sections", "comma-separated digest section names in priority order (SECTIONS)")
+}
+
+// stringList is a flag.Value for comma-separated lists
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = splitList(v)
+	return nil
+}
+
+// splitList splits a comma-separated value, trimming whitespace around entries
+func splitList(v string) []string {
+	var out []string
+	if v == "" {
+		return out
+	}
+	for _, item := range strings.Split(v, ",") {
+		out = append(out, strings.TrimSpace(item))
+	}
+	return out
+}
+
+// sectionList is a flag.Value for comma-separated section names
+type sectionList []Section
+
+func (l *sectionList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(SectionNames(*l), ",")
+}
+
+func (l *sectionList) Set(v string) error {
+	*l = sectionsNamed(splitList(v))
+	return nil
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultProfile is the name of the single profile used when PROFILES is not set
+const DefaultProfile = "default"
+
+var profileNameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Profile is a named digest. Empty fields fall back to the top-level settings.
+type Profile struct {
+	Name             string           `yaml:"name"`
+	GmailQuery       string           `yaml:"gmail_query,omitempty"`
+	ToEmail          string           `yaml:"to_email,omitempty"`
+	PromptSingle     string           `yaml:"prompt_single_summary,omitempty"`
+	PromptFinal      string           `yaml:"prompt_final_synthesis,omitempty"`
+	PromptsDir       string           `yaml:"prompts_dir,omitempty"`
+	Audience         string           `yaml:"audience,omitempty"`
+	LinkedInHashtags []string         `yaml:"linkedin_hashtags,omitempty"`
+	Sections         []Section        `yaml:"sections,omitempty"`
+	Senders          []SenderRule     `yaml:"senders,omitempty"` // replace the top-level sender rules
+	Schedule         string           `yaml:"schedule,omitempty"`
+	Tunables         TunableOverrides `yaml:",inline"`
+}
+
+// applyProfileEnv applies the profile environment variables. PROFILES, when
+// set, replaces the list of profiles, keeping the config file settings of the
+// profiles it names. Each profile's settings are then overridden by its
+// PROFILE_<NAME>_* variables, e.g. PROFILE_PRODUCT_GMAIL_QUERY.
+func (c *Config) applyProfileEnv() error {
+	if v := os.Getenv("PROFILES"); v != "" {
+		var profiles []Profile
+		for _, name := range splitList(v) {
+			if name == "" {
+				continue
+			}
+			i := slices.IndexFunc(c.Profiles, func(p Profile) bool { return p.Name == name })
+			if i == -1 {
+				profiles = append(profiles, Profile{Name: name})
+			} else {
+				profiles = append(profiles, c.Profiles[i])
+			}
+		}
+		c.Profiles = profiles
+	}
+
+	var errs []error
+	for i := range c.Profiles {
+		p := &c.Profiles[i]
+		prefix := profileEnvPrefix(p.Name)
+		str := func(key string, dst *string) {
+			if v := os.Getenv(prefix + key); v != "" {
+				*dst = v
+			}
+		}
+		list := func(key string, dst *[]string) {
+			if v := os.Getenv(prefix + key); v != "" {
+				*dst = splitList(v)
+			}
+		}
+		str("GMAIL_QUERY", &p.GmailQuery)
+		str("TO_EMAIL", &p.ToEmail)
+		str("PROMPT_SINGLE_SUMMARY", &p.PromptSingle)
+		str("PROMPT_FINAL_SYNTHESIS", &p.PromptFinal)
+		str("PROMPTS_DIR", &p.PromptsDir)
+		str("AUDIENCE", &p.Audience)
+		list("LINKEDIN_HASHTAGS", &p.LinkedInHashtags)
+		if v := os.Getenv(prefix + "SECTIONS"); v != "" {
+			p.Sections = sectionsNamed(splitList(v))
+		}
+		str("SCHEDULE", &p.Schedule)
+		if err := p.Tunables.applyEnv(prefix); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// profileEnvPrefix returns the environment variable prefix of a profile,
+// e.g. PROFILE_ARCH_GUILD_ for "arch-guild"
+func profileEnvPrefix(name string) string {
+	return "PROFILE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
+// ProfileConfigs returns one configuration per profile: a copy of c with the
+// profile's settings applied, and the command-line flags over them. Without
+// profiles, c itself is the only one.
+func (c *Config) ProfileConfigs() []*Config {
+	if len(c.Profiles) == 0 {
+		return []*Config{c}
+	}
+
+	out := make([]*Config, 0, len(c.Profiles))
+	for _, p := range c.Profiles {
+		pc := *c
+		pc.Profile = p.Name
+		pc.Profiles = nil
+		if p.GmailQuery != "" {
+			pc.GmailQuery = p.GmailQuery
+		}
+		if p.ToEmail != "" {
+			pc.ToEmail = p.ToEmail
+		}
+		if p.PromptSingle != "" {
+			pc.PromptSingle = p.PromptSingle
+		}
+		if p.PromptFinal != "" {
+			pc.PromptFinal = p.PromptFinal
+		}
+		if p.PromptsDir != "" {
+			pc.PromptsDir = p.PromptsDir
+		}
+		if p.Audience != "" {
+			pc.Audience = p.Audience
+		}
+		if len(p.LinkedInHashtags) > 0 {
+			pc.LinkedInHashtags = p.LinkedInHashtags
+		}
+		if len(p.Sections) > 0 {
+			pc.Sections = p.Sections
+		}
+		if len(p.Senders) > 0 {
+			pc.Senders = p.Senders
+		}
+		if p.Schedule != "" {
+			pc.Schedule = p.Schedule
+		}
+		p.Tunables.apply(&pc.Tunables)
+		pc.applyFlags()
+		out = append(out, &pc)
+	}
+	return out
+}
+
+// SelectProfiles returns the configurations of the named profiles, or of all
+// profiles when names is empty
+func (c *Config) SelectProfiles(names []string) ([]*Config, error) {
+	all := c.ProfileConfigs()
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	var out []*Config
+	for _, name := range names {
+		i := slices.IndexFunc(all, func(pc *Config) bool { return pc.Profile == name })
+		if i == -1 {
+			return nil, fmt.Errorf("unknown profile %q", name)
+		}
+		out = append(out, all[i])
+	}
+	return out, nil
+}
+
+// validateProfiles checks profile names, the shared settings and the
+// settings of each profile. Every problem of a profile is reported on its own
+// line, prefixed with the profile name; problems all profiles have come from
+// the top-level settings and are reported once.
+func (c *Config) validateProfiles() error {
+	seen := make(map[string]bool)
+	var errs []error
+	for _, p := range c.Profiles {
+		if !profileNameRE.MatchString(p.Name) {
+			errs = append(errs, fmt.Errorf("invalid profile name %q (use letters, digits, '-' and '_')", p.Name))
+			continue
+		}
+		if seen[p.Name] {
+			errs = append(errs, fmt.Errorf("duplicate profile %q", p.Name))
+		}
+		seen[p.Name] = true
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if err := c.validateShared(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.Profiles) == 0 {
+		return errors.Join(append(errs, c.validateFields())...)
+	}
+
+	profileCfgs := c.ProfileConfigs()
+	problems := make([][]string, len(profileCfgs))
+	count := make(map[string]int)
+	for i, pc := range profileCfgs {
+		if err := pc.validateFields(); err != nil {
+			problems[i] = strings.Split(err.Error(), "\n")
+			for _, line := range slices.Compact(slices.Sorted(slices.Values(problems[i]))) {
+				count[line]++
+			}
+		}
+	}
+	shared := func(line string) bool {
+		return len(profileCfgs) > 1 && count[line] == len(profileCfgs)
+	}
+	for _, line := range problems[0] {
+		if shared(line) {
+			errs = append(errs, errors.New(line))
+		}
+	}
+	for i, pc := range profileCfgs {
+		for _, line := range problems[i] {
+			if !shared(line) {
+				errs = append(errs, fmt.Errorf("profile %s: %s", pc.Profile, line))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProfileConfigs(t *testing.T) {
+	t.Setenv("TO_EMAIL", "me@example.com")
+	t.Setenv("GMAIL_QUERY", "label:newsletter is:unread")
+	t.Setenv("PROFILES", "product, arch-guild")
+	t.Setenv("PROFILE_PRODUCT_TO_EMAIL", "pm-leads@example.com, cpo@example.com")
+	t.Setenv("PROFILE_ARCH_GUILD_GMAIL_QUERY", "label:architecture is:unread")
+	t.Setenv("PROFILE_ARCH_GUILD_SECTIONS", "Software Architecture,Team Organization")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	profiles := cfg.ProfileConfigs()
+	if len(profiles) != 2 {
+		t.Fatalf("Expected 2 profiles, got %d", len(profiles))
+	}
+
+	product, arch := profiles[0], profiles[1]
+	if product.Profile != "product" || arch.Profile != "arch-guild" {
+		t.Errorf("Unexpected profile names %q, %q", product.Profile, arch.Profile)
+	}
+	if product.ToEmail != "pm-leads@example.com, cpo@example.com" || product.GmailQuery != "label:newsletter is:unread" {
+		t.Errorf("Expected product to override only the recipients, got %q / %q", product.ToEmail, product.GmailQuery)
+	}
+	if arch.ToEmail != "me@example.com" || arch.GmailQuery != "label:architecture is:unread" {
+		t.Errorf("Expected arch-guild to override only the query, got %q / %q", arch.ToEmail, arch.GmailQuery)
+	}
+	if !slices.Equal(SectionNames(arch.Sections), []string{"Software Architecture", "Team Organization"}) {
+		t.Errorf("Unexpected arch-guild sections %v", arch.Sections)
+	}
+	if !slices.Equal(SectionNames(product.Sections), SectionNames(DefaultSections)) {
+		t.Errorf("Expected product to keep the default sections, got %v", product.Sections)
+	}
+
+	selected, err := cfg.SelectProfiles([]string{"arch-guild"})
+	if err != nil {
+		t.Fatalf("SelectProfiles failed: %v", err)
+	}
+	if len(selected) != 1 || selected[0].Profile != "arch-guild" {
+		t.Errorf("Expected only arch-guild, got %d profiles", len(selected))
+	}
+	if _, err := cfg.SelectProfiles([]string{"missing"}); err == nil {
+		t.Error("Expected error selecting an unknown profile")
+	}
+}
+
+func TestFlagsOverrideProfiles(t *testing.T) {
+	t.Setenv("TO_EMAIL", "me@example.com")
+	t.Setenv("PROFILES", "product,arch")
+	t.Setenv("PROFILE_PRODUCT_TO_EMAIL", "pm-leads@example.com")
+	t.Setenv("PROFILE_PRODUCT_RETRY_MAX", "2")
+	t.Setenv("PROFILE_ARCH_GMAIL_QUERY", "label:architecture")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.String("profile", "", "")
+	cfg.BindFlags(fs)
+	if err := fs.Parse([]string{"--profile", "product", "--to-email", "test@example.com", "--retry-max", "7"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	for _, pc := range cfg.ProfileConfigs() {
+		if pc.ToEmail != "test@example.com" || pc.RetryMax != 7 {
+			t.Errorf("Profile %s: expected the flags to win, got %q and %d retries", pc.Profile, pc.ToEmail, pc.RetryMax)
+		}
+		if pc.Profile == "arch" && pc.GmailQuery != "label:architecture" {
+			t.Errorf("Expected arch to keep its query, got %q", pc.GmailQuery)
+		}
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	cfg := &Config{
+		ToEmail:  "me@example.com",
+		Tunables: DefaultTunables(),
+		Sections: DefaultSections,
+		Profiles: []Profile{
+			{Name: "product"},
+			{Name: "product"},
+		},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for duplicate profile names")
+	}
+
+	cfg.Profiles = []Profile{{Name: "product", ToEmail: "not an address"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an invalid profile recipient")
+	}
+}
+
+func TestValidateProfilesReportsEachProblem(t *testing.T) {
+	cfg := Default()
+	cfg.LogLevel = "loud"
+	cfg.Audience = " "
+	cfg.Profiles = []Profile{
+		{Name: "product", ToEmail: "not an address"},
+		{Name: "arch", ToEmail: "guild@example.com"},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+	lines := strings.Split(err.Error(), "\n")
+	for _, want := range []string{
+		`invalid log level "loud" (want debug, info, warn or error)`,
+		"audience must not be empty",
+		`profile product: invalid recipient "not an address": mail: no angle-addr`,
+	} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("Expected line %q, got:\n%v", want, err)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "audience") && line != "audience must not be empty" {
+			t.Errorf("Expected the shared audience problem once without a profile, got %q", line)
+		}
+	}
+}
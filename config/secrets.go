@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretEnv lists the secrets, which are never printed. Each can be given as
+// NAME, as NAME_FILE naming a file that holds it, or as NAME_COMMAND, a
+// command printing it; the API keys can also be kept in the credential store.
+var secretEnv = []string{"ANTHROPIC_API_KEY", "CREDENTIALS_PASSPHRASE", "FORUMSCOUT_API_KEY"}
+
+// secretCommandTimeout bounds a secret helper command
+const secretCommandTimeout = 30 * time.Second
+
+type secret struct {
+	value  string
+	source string // the variable it was resolved from
+}
+
+var (
+	secretsMu sync.RWMutex
+	secrets   map[string]secret
+)
+
+// ResolveSecrets resolves the named secrets, or every secret when no name is
+// given. Commands resolve only the secrets they use, so that no helper
+// command runs for the others. Errors name the variable and file or command
+// involved but never include a secret.
+func ResolveSecrets(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		names = secretEnv
+	}
+	resolved := make(map[string]secret)
+	var errs []error
+	for _, name := range names {
+		s, err := resolveSecret(ctx, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resolved[name] = s
+	}
+
+	secretsMu.Lock()
+	if secrets == nil {
+		secrets = make(map[string]secret)
+	}
+	maps.Copy(secrets, resolved)
+	secretsMu.Unlock()
+	return errors.Join(errs...)
+}
+
+// FillSecrets sets the secrets the environment leaves unset from stored, a
+// map of secret names to values kept elsewhere, such as the credential store.
+// source names where they came from.
+func FillSecrets(stored map[string]string, source string) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if secrets == nil {
+		secrets = make(map[string]secret)
+	}
+	for _, name := range secretEnv {
+		if s, ok := secrets[name]; ok && s.value != "" {
+			continue
+		}
+		if os.Getenv(name) != "" {
+			continue
+		}
+		if v := stored[name]; v != "" {
+			secrets[name] = secret{value: v, source: source}
+		}
+	}
+}
+
+// Secret returns a secret resolved by ResolveSecrets. Before resolution, the
+// plain environment variable is returned.
+func Secret(name string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	if s, ok := secrets[name]; ok {
+		return s.value
+	}
+	return os.Getenv(name)
+}
+
+// SecretSource returns the variable a secret was resolved from, or "" when
+// it is not set. Before resolution, it is the variable that would be used.
+func SecretSource(name string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	if s, ok := secrets[name]; ok {
+		return s.source
+	}
+	for _, key := range []string{name + "_FILE", name + "_COMMAND", name} {
+		if os.Getenv(key) != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// ResolveSecret resolves a secret outside secretEnv, which is needed only by
+// one command, from NAME, NAME_FILE or NAME_COMMAND. It returns "" when none
+// is set.
+func ResolveSecret(ctx context.Context, name string) (string, error) {
+	s, err := resolveSecret(ctx, name)
+	return s.value, err
+}
+
+func resolveSecret(ctx context.Context, name string) (secret, error) {
+	value, file, command := os.Getenv(name), os.Getenv(name+"_FILE"), os.Getenv(name+"_COMMAND")
+
+	var set []string
+	for _, v := range []struct{ key, value string }{{name, value}, {name + "_FILE", file}, {name + "_COMMAND", command}} {
+		if v.value != "" {
+			set = append(set, v.key)
+		}
+	}
+	if len(set) > 1 {
+		return secret{}, fmt.Errorf("%s is set more than once (%s); set only one", name, strings.Join(set, ", "))
+	}
+
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return secret{}, fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		v := strings.TrimRight(string(data), "\r\n")
+		if v == "" {
+			return secret{}, fmt.Errorf("%s_FILE: %s is empty", name, file)
+		}
+		return secret{value: v, source: name + "_FILE"}, nil
+
+	case command != "":
+		ctx, cancel := context.WithTimeout(ctx, secretCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		cmd.Stdin = os.Stdin // helpers may ask for confirmation
+		if err := cmd.Run(); err != nil {
+			// Only stderr is reported; stdout may hold part of the secret
+			msg := strings.TrimSpace(stderr.String())
+			if msg != "" {
+				return secret{}, fmt.Errorf("%s_COMMAND failed: %w: %s", name, err, msg)
+			}
+			return secret{}, fmt.Errorf("%s_COMMAND failed: %w", name, err)
+		}
+		v := strings.TrimRight(stdout.String(), "\r\n")
+		if v == "" {
+			return secret{}, fmt.Errorf("%s_COMMAND printed nothing", name)
+		}
+		return secret{value: v, source: name + "_COMMAND"}, nil
+
+	case value != "":
+		return secret{value: value, source: name}, nil
+	}
+	return secret{}, nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearSecrets unsets every secret variable of the environment and forgets
+// the resolved secrets when the test ends
+func clearSecrets(t *testing.T) {
+	t.Helper()
+	for _, name := range secretEnv {
+		for _, suffix := range []string{"", "_FILE", "_COMMAND"} {
+			t.Setenv(name+suffix, "")
+		}
+	}
+	t.Cleanup(func() {
+		secretsMu.Lock()
+		secrets = nil
+		secretsMu.Unlock()
+	})
+}
+
+func TestResolveSecrets(t *testing.T) {
+	clearSecrets(t)
+
+	path := filepath.Join(t.TempDir(), "anthropic")
+	if err := os.WriteFile(path, []byte("sk-from-file\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	t.Setenv("ANTHROPIC_API_KEY_FILE", path)
+	t.Setenv("CREDENTIALS_PASSPHRASE_COMMAND", "echo from-command")
+	t.Setenv("FORUMSCOUT_API_KEY", "plain")
+
+	if err := ResolveSecrets(context.Background()); err != nil {
+		t.Fatalf("ResolveSecrets failed: %v", err)
+	}
+	for name, want := range map[string]string{
+		"ANTHROPIC_API_KEY":      "sk-from-file",
+		"CREDENTIALS_PASSPHRASE": "from-command",
+		"FORUMSCOUT_API_KEY":     "plain",
+	} {
+		if got := Secret(name); got != want {
+			t.Errorf("Secret(%s) = %q, want %q", name, got, want)
+		}
+	}
+	if got := SecretSource("CREDENTIALS_PASSPHRASE"); got != "CREDENTIALS_PASSPHRASE_COMMAND" {
+		t.Errorf("Unexpected source %q", got)
+	}
+}
+
+func TestResolveSecretsErrors(t *testing.T) {
+	clearSecrets(t)
+
+	t.Setenv("ANTHROPIC_API_KEY", "sk-plain")
+	t.Setenv("ANTHROPIC_API_KEY_FILE", "/some/file")
+	t.Setenv("CREDENTIALS_PASSPHRASE_COMMAND", "echo leaked-secret; echo helper broke >&2; exit 3")
+	t.Setenv("FORUMSCOUT_API_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	err := ResolveSecrets(context.Background())
+	if err == nil {
+		t.Fatal("Expected ResolveSecrets to fail")
+	}
+	for _, want := range []string{
+		"ANTHROPIC_API_KEY is set more than once (ANTHROPIC_API_KEY, ANTHROPIC_API_KEY_FILE)",
+		"CREDENTIALS_PASSPHRASE_COMMAND failed: exit status 3: helper broke",
+		"FORUMSCOUT_API_KEY_FILE",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected problem %q, got:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "leaked-secret") || strings.Contains(err.Error(), "sk-plain") {
+		t.Errorf("Error reveals a secret: %v", err)
+	}
+}
+
+func TestFillSecrets(t *testing.T) {
+	clearSecrets(t)
+	t.Setenv("ANTHROPIC_API_KEY", "from-env")
+	t.Setenv("FORUMSCOUT_API_KEY", "")
+
+	if err := ResolveSecrets(context.Background()); err != nil {
+		t.Fatalf("ResolveSecrets failed: %v", err)
+	}
+	FillSecrets(map[string]string{"ANTHROPIC_API_KEY": "stored", "FORUMSCOUT_API_KEY": "stored-fs", "OTHER": "x"}, "store")
+
+	if got := Secret("ANTHROPIC_API_KEY"); got != "from-env" {
+		t.Errorf("Secret(ANTHROPIC_API_KEY) = %q, want the environment to take precedence", got)
+	}
+	if got, src := Secret("FORUMSCOUT_API_KEY"), SecretSource("FORUMSCOUT_API_KEY"); got != "stored-fs" || src != "store" {
+		t.Errorf("FORUMSCOUT_API_KEY = %q from %q, want the stored value", got, src)
+	}
+	if got := Secret("OTHER"); got != "" {
+		t.Errorf("Secret(OTHER) = %q, want only known secrets filled", got)
+	}
+}
+
+func TestResolveNamedSecrets(t *testing.T) {
+	clearSecrets(t)
+	t.Setenv("ANTHROPIC_API_KEY_COMMAND", "exit 1")
+	t.Setenv("CREDENTIALS_PASSPHRASE", "pass")
+
+	if err := ResolveSecrets(context.Background(), "CREDENTIALS_PASSPHRASE"); err != nil {
+		t.Fatalf("ResolveSecrets ran the helper of a secret it was not asked for: %v", err)
+	}
+	if got := Secret("CREDENTIALS_PASSPHRASE"); got != "pass" {
+		t.Errorf("Secret(CREDENTIALS_PASSPHRASE) = %q, want pass", got)
+	}
+	if got := SecretSource("ANTHROPIC_API_KEY"); got != "ANTHROPIC_API_KEY_COMMAND" {
+		t.Errorf("SecretSource of an unresolved secret = %q, want ANTHROPIC_API_KEY_COMMAND", got)
+	}
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Section is one section of the digest
+type Section struct {
+	Name        string   `yaml:"name"`
+	Aliases     []string `yaml:"aliases,omitempty"`     // other headings the model may use for the section
+	Description string   `yaml:"description,omitempty"` // what belongs in the section, given to the model
+	Order       int      `yaml:"order,omitempty"`       // position in the digest; sections without one keep their list order
+	Optional    bool     `yaml:"optional,omitempty"`    // the digest is valid without the section
+}
+
+// DefaultSections are the digest sections in priority order
+var DefaultSections = []Section{
+	{
+		Name:        "Product Management",
+		Aliases:     []string{"Product"},
+		Description: "product strategy, discovery, roadmaps, pricing and product leadership",
+	},
+	{
+		Name:        "Healthcare",
+		Aliases:     []string{"Health", "Digital Health", "eHealth"},
+		Description: "healthcare, eHealth, clinical and health-tech developments",
+	},
+	{
+		Name:        "Software Architecture",
+		Aliases:     []string{"Architecture", "Software Architecture & Technology"},
+		Description: "software architecture, system design, cloud architecture, microservices, APIs, technical architecture, DevOps and infrastructure. NOT building, physical or construction-related architecture",
+	},
+	{
+		Name:        "Team Organization",
+		Aliases:     []string{"Team Organisation", "Teams"},
+		Description: "team structures, engineering and product leadership, hiring and ways of working",
+	},
+	{
+		Name:        "AI",
+		Aliases:     []string{"Artificial Intelligence"},
+		Description: "AI developments that clearly matter for the sections above",
+		Optional:    true,
+	},
+}
+
+// UnmarshalYAML accepts a section either as a plain name or as a mapping
+func (s *Section) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = sectionNamed(node.Value)
+		return nil
+	}
+	// Returning a TypeError lets the decoder report the problem along with
+	// the others instead of stopping
+	if node.Kind != yaml.MappingNode {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: a section is a name or a mapping", node.Line)}}
+	}
+
+	// node.Decode does not reject unknown keys, so check them here
+	var unknown []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		switch key.Value {
+		case "name", "aliases", "description", "order", "optional":
+		default:
+			unknown = append(unknown, fmt.Sprintf("line %d: field %s not found in type config.Section", key.Line, key.Value))
+		}
+	}
+	if len(unknown) > 0 {
+		return &yaml.TypeError{Errors: unknown}
+	}
+
+	type plain Section
+	return node.Decode((*plain)(s))
+}
+
+// sectionNamed returns the default section called name, or a section with
+// just that name
+func sectionNamed(name string) Section {
+	name = strings.TrimSpace(name)
+	for _, s := range DefaultSections {
+		if strings.EqualFold(s.Name, name) {
+			return s
+		}
+	}
+	return Section{Name: name}
+}
+
+// sectionsNamed turns a list of names into sections
+func sectionsNamed(names []string) []Section {
+	out := make([]Section, len(names))
+	for i, name := range names {
+		out[i] = sectionNamed(name)
+	}
+	return out
+}
+
+// SectionNames returns the names of sections
+func SectionNames(sections []Section) []string {
+	names := make([]string, len(sections))
+	for i, s := range sections {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// SortedSections returns sections in digest order: by Order, keeping the list
+// order among sections with the same Order
+func SortedSections(sections []Section) []Section {
+	out := slices.Clone(sections)
+	slices.SortStableFunc(out, func(a, b Section) int { return a.Order - b.Order })
+	return out
+}
+
+// MatchSection returns the section a heading written by the model refers to.
+// Names and aliases match regardless of case, surrounding whitespace and a
+// leading "1)" or "1." numbering.
+func MatchSection(sections []Section, heading string) (Section, bool) {
+	heading = normalizeHeading(heading)
+	for _, s := range sections {
+		if normalizeHeading(s.Name) == heading {
+			return s, true
+		}
+		for _, alias := range s.Aliases {
+			if normalizeHeading(alias) == heading {
+				return s, true
+			}
+		}
+	}
+	return Section{}, false
+}
+
+func normalizeHeading(h string) string {
+	h = strings.TrimSpace(h)
+	if i := strings.IndexAny(h, ").:"); i > 0 && strings.Trim(h[:i], "0123456789") == "" {
+		h = strings.TrimSpace(h[i+1:])
+	}
+	return strings.ToLower(strings.Join(strings.Fields(h), " "))
+}
+
+// validateSections checks that sections can be told apart
+func validateSections(sections []Section) error {
+	if len(sections) == 0 {
+		return errors.New("no digest sections configured")
+	}
+
+	var errs []error
+	seen := make(map[string]string)
+	for _, s := range sections {
+		if strings.TrimSpace(s.Name) == "" {
+			errs = append(errs, errors.New("section without a name"))
+			continue
+		}
+		for _, h := range append([]string{s.Name}, s.Aliases...) {
+			key := normalizeHeading(h)
+			if key == "" {
+				errs = append(errs, fmt.Errorf("section %s: empty alias", s.Name))
+				continue
+			}
+			if other, ok := seen[key]; ok {
+				errs = append(errs, fmt.Errorf("section heading %q used by both %s and %s", h, other, s.Name))
+				continue
+			}
+			seen[key] = s.Name
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DigestSections returns the configured sections in digest order
+func (c *Config) DigestSections() []Section {
+	return SortedSections(c.Sections)
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchSection(t *testing.T) {
+	for heading, want := range map[string]string{
+		"Software Architecture":              "Software Architecture",
+		"software  architecture":             "Software Architecture",
+		"Software Architecture & Technology": "Software Architecture",
+		"3) Architecture":                    "Software Architecture",
+		"1. Product":                         "Product Management",
+		"Artificial Intelligence":            "AI",
+		" Team Organisation ":                "Team Organization",
+	} {
+		s, ok := MatchSection(DefaultSections, heading)
+		if !ok || s.Name != want {
+			t.Errorf("MatchSection(%q) = %q, %v; want %q", heading, s.Name, ok, want)
+		}
+	}
+	if _, ok := MatchSection(DefaultSections, "Sports"); ok {
+		t.Error("Expected no match for an unknown heading")
+	}
+}
+
+func TestLoadSections(t *testing.T) {
+	path := writeConfigFile(t, `
+to_email: me@example.com
+sections:
+  - Healthcare
+  - name: Platform Engineering
+    aliases: [Platform, Infrastructure]
+    description: internal developer platforms
+    order: -1
+  - name: AI
+    optional: true
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	sections := cfg.DigestSections()
+	if got := strings.Join(SectionNames(sections), ","); got != "Platform Engineering,Healthcare,AI" {
+		t.Fatalf("Unexpected section order %s", got)
+	}
+	if len(sections[1].Aliases) == 0 {
+		t.Error("Expected a section given by name to keep its default aliases")
+	}
+	if s, ok := MatchSection(cfg.Sections, "infrastructure"); !ok || s.Name != "Platform Engineering" {
+		t.Errorf("Expected the alias to match, got %q", s.Name)
+	}
+}
+
+func TestValidateSections(t *testing.T) {
+	if err := validateSections(nil); err == nil {
+		t.Error("Expected error for no sections")
+	}
+	err := validateSections([]Section{
+		{Name: "Product Management", Aliases: []string{"Teams"}},
+		{Name: "Team Organization", Aliases: []string{"teams"}},
+		{Aliases: []string{"Nameless"}},
+	})
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+	for _, want := range []string{`"teams" used by both`, "section without a name"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected problem %q, got: %v", want, err)
+		}
+	}
+
+	path := writeConfigFile(t, `
+sections:
+  - name: Product
+    colour: blue
+`)
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("Expected unknown section key to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"path"
+	"strings"
+)
+
+// Values of SenderRule.Include
+const (
+	IncludeAlways = "always" // keep the newsletter however short it is, unless empty
+	IncludeNever  = "never"  // leave the newsletter out of the digest
+)
+
+// SenderRule adjusts how the newsletters of matching senders are handled.
+// From and ListID are patterns as in path.Match, matched without regard to
+// case; a rule with both needs both to match.
+type SenderRule struct {
+	From             string `yaml:"from,omitempty"`               // sender address, e.g. news@example.com or *@substack.com
+	ListID           string `yaml:"list_id,omitempty"`            // List-Id header, e.g. *.substack.com
+	Priority         int    `yaml:"priority,omitempty"`           // higher priorities come first in the digest input
+	MaxChars         int    `yaml:"max_chars,omitempty"`          // replaces per_email_max_chars
+	Prompt           string `yaml:"prompt,omitempty"`             // replaces the single summary system prompt
+	Section          string `yaml:"section,omitempty"`            // section the newsletter always goes into
+	Include          string `yaml:"include,omitempty"`            // always or never
+	FetchFullContent *bool  `yaml:"fetch_full_content,omitempty"` // replaces fetch_full_content
+}
+
+// SenderRule returns the first rule matching a newsletter's From and List-Id
+// headers, or nil
+func (c *Config) SenderRule(from, listID string) *SenderRule {
+	from = strings.ToLower(senderAddress(from))
+	listID = strings.ToLower(listIdentifier(listID))
+	for i := range c.Senders {
+		r := &c.Senders[i]
+		if r.From != "" && !patternMatch(r.From, from) {
+			continue
+		}
+		if r.ListID != "" && !patternMatch(r.ListID, listID) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+func patternMatch(pattern, s string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), s)
+	return ok
+}
+
+// senderAddress returns the address of a From header
+func senderAddress(from string) string {
+	if a, err := mail.ParseAddress(from); err == nil {
+		return a.Address
+	}
+	return strings.TrimSpace(from)
+}
+
+// listIdentifier returns the identifier of a List-Id header, which is written
+// as "Description <list.example.com>"
+func listIdentifier(listID string) string {
+	if i := strings.LastIndex(listID, "<"); i != -1 {
+		if j := strings.Index(listID[i:], ">"); j != -1 {
+			return strings.TrimSpace(listID[i+1 : i+j])
+		}
+	}
+	return strings.TrimSpace(listID)
+}
+
+// validateSenderRules checks the rules against the configured sections
+func validateSenderRules(rules []SenderRule, sections []Section) error {
+	var errs []error
+	for i, r := range rules {
+		name := fmt.Sprintf("sender rule %d", i+1)
+		if r.From == "" && r.ListID == "" {
+			errs = append(errs, fmt.Errorf("%s: set from or list_id", name))
+		}
+		for _, p := range []string{r.From, r.ListID} {
+			if _, err := path.Match(p, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid pattern %q: %w", name, p, err))
+			}
+		}
+		if r.MaxChars < 0 {
+			errs = append(errs, fmt.Errorf("%s: max_chars must not be negative, got %d", name, r.MaxChars))
+		}
+		if r.Include != "" && r.Include != IncludeAlways && r.Include != IncludeNever {
+			errs = append(errs, fmt.Errorf("%s: invalid include %q (want %s or %s)", name, r.Include, IncludeAlways, IncludeNever))
+		}
+		if _, ok := MatchSection(sections, r.Section); r.Section != "" && !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown section %q", name, r.Section))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSenderRule(t *testing.T) {
+	path := writeConfigFile(t, `
+to_email: me@example.com
+senders:
+  - from: "*@roundup.example.com"
+    include: never
+  - list_id: "*.substack.com"
+    max_chars: 12000
+    fetch_full_content: false
+  - from: essays@example.com
+    priority: 10
+    section: Architecture
+    include: always
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	if r := cfg.SenderRule("Roundup <Links@Roundup.example.com>", ""); r == nil || r.Include != IncludeNever {
+		t.Errorf("Expected the roundup rule, got %+v", r)
+	}
+	r := cfg.SenderRule("Writer <writer@example.com>", "Writer's Notes <writer.substack.com>")
+	if r == nil || r.MaxChars != 12000 || r.FetchFullContent == nil || *r.FetchFullContent {
+		t.Errorf("Expected the substack rule, got %+v", r)
+	}
+	if r := cfg.SenderRule("essays@example.com", ""); r == nil || r.Priority != 10 || r.Include != IncludeAlways {
+		t.Errorf("Expected the essays rule, got %+v", r)
+	}
+	if r := cfg.SenderRule("other@example.com", "list.example.com"); r != nil {
+		t.Errorf("Expected no rule, got %+v", r)
+	}
+}
+
+func TestValidateSenderRules(t *testing.T) {
+	err := validateSenderRules([]SenderRule{
+		{Priority: 1},
+		{From: "[bad", Include: "sometimes"},
+		{From: "a@example.com", Section: "Sports", MaxChars: -1},
+	}, DefaultSections)
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+	for _, want := range []string{
+		"sender rule 1: set from or list_id",
+		`sender rule 2: invalid pattern "[bad"`,
+		`sender rule 2: invalid include "sometimes"`,
+		`sender rule 3: unknown section "Sports"`,
+		"sender rule 3: max_chars must not be negative",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected problem %q, got:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tunables are the limits and pacing of a run. Every tunable can be set in the
+// config file, by the environment variable named after its upper-cased key
+// (e.g. RETRY_MAX), by flag and per profile.
+type Tunables struct {
+	MaxResults         int64         `yaml:"max_results"`          // messages fetched per run
+	PerEmailMaxChars   int           `yaml:"per_email_max_chars"`  // newsletter text sent for summarization
+	PerEmailSleep      time.Duration `yaml:"per_email_sleep"`      // pause between newsletter summaries
+	RetryMax           int           `yaml:"retry_max"`            // attempts per Claude request
+	BackoffMin         time.Duration `yaml:"backoff_min"`          // first retry backoff, doubled per attempt
+	BackoffMax         time.Duration `yaml:"backoff_max"`          // longest retry backoff
+	LinkedInFetchPosts int           `yaml:"linkedin_fetch_posts"` // LinkedIn posts fetched before filtering
+	LinkedInMaxPosts   int           `yaml:"linkedin_max_posts"`   // LinkedIn posts kept for the digest
+	MinTextChars       int           `yaml:"min_text_chars"`       // shortest message text counted as a newsletter
+	ArticleMaxChars    int           `yaml:"article_max_chars"`    // full LinkedIn article text kept
+	LinkedInMaxAge     time.Duration `yaml:"linkedin_max_age"`     // oldest LinkedIn post included
+}
+
+// DefaultTunables returns the tunables used when nothing is configured
+func DefaultTunables() Tunables {
+	return Tunables{
+		MaxResults:         MaxResults,
+		PerEmailMaxChars:   PerEmailMaxChars,
+		PerEmailSleep:      PerEmailSleep,
+		RetryMax:           RetryMax,
+		BackoffMin:         BackoffMin,
+		BackoffMax:         BackoffMax,
+		LinkedInFetchPosts: LinkedInFetchPosts,
+		LinkedInMaxPosts:   LinkedInMaxPosts,
+		MinTextChars:       MinTextChars,
+		ArticleMaxChars:    ArticleMaxChars,
+		LinkedInMaxAge:     LinkedInMaxAge,
+	}
+}
+
+// TunableOverrides are the tunables a profile sets; nil fields keep the
+// top-level value. Field names match those of Tunables.
+type TunableOverrides struct {
+	MaxResults         *int64         `yaml:"max_results,omitempty"`
+	PerEmailMaxChars   *int           `yaml:"per_email_max_chars,omitempty"`
+	PerEmailSleep      *time.Duration `yaml:"per_email_sleep,omitempty"`
+	RetryMax           *int           `yaml:"retry_max,omitempty"`
+	BackoffMin         *time.Duration `yaml:"backoff_min,omitempty"`
+	BackoffMax         *time.Duration `yaml:"backoff_max,omitempty"`
+	LinkedInFetchPosts *int           `yaml:"linkedin_fetch_posts,omitempty"`
+	LinkedInMaxPosts   *int           `yaml:"linkedin_max_posts,omitempty"`
+	MinTextChars       *int           `yaml:"min_text_chars,omitempty"`
+	ArticleMaxChars    *int           `yaml:"article_max_chars,omitempty"`
+	LinkedInMaxAge     *time.Duration `yaml:"linkedin_max_age,omitempty"`
+}
+
+// apply sets the overridden tunables in t
+func (o *TunableOverrides) apply(t *Tunables) {
+	ov, tv := reflect.ValueOf(o).Elem(), reflect.ValueOf(t).Elem()
+	for i := 0; i < ov.NumField(); i++ {
+		if f := ov.Field(i); !f.IsNil() {
+			tv.FieldByName(ov.Type().Field(i).Name).Set(f.Elem())
+		}
+	}
+}
+
+// applyEnv sets the tunables from the environment variables prefix+KEY that
+// are set
+func (t *Tunables) applyEnv(prefix string) error {
+	tv := reflect.ValueOf(t).Elem()
+	var errs []error
+	for i := 0; i < tv.NumField(); i++ {
+		key := prefix + tunableEnvKey(tv.Type().Field(i))
+		if v := os.Getenv(key); v != "" {
+			if err := setTunable(tv.Field(i), v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyEnv sets the overrides from the environment variables prefix+KEY that
+// are set
+func (o *TunableOverrides) applyEnv(prefix string) error {
+	ov := reflect.ValueOf(o).Elem()
+	var errs []error
+	for i := 0; i < ov.NumField(); i++ {
+		key := prefix + tunableEnvKey(ov.Type().Field(i))
+		if v := os.Getenv(key); v != "" {
+			f := reflect.New(ov.Field(i).Type().Elem())
+			if err := setTunable(f.Elem(), v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				continue
+			}
+			ov.Field(i).Set(f)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func tunableEnvKey(f reflect.StructField) string {
+	return strings.ToUpper(strings.Split(f.Tag.Get("yaml"), ",")[0])
+}
+
+// setTunable parses v into an integer or duration field
+func setTunable(f reflect.Value, v string) error {
+	if f.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q (e.g. 1500ms, 6s, 168h)", v)
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+	f.SetInt(n)
+	return nil
+}
+
+// validate checks that the tunables make sense together
+func (t *Tunables) validate() error {
+	var errs []error
+	positive := func(name string, v int64) {
+		if v <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %d", name, v))
+		}
+	}
+	positive("max results", t.MaxResults)
+	positive("per-email max chars", int64(t.PerEmailMaxChars))
+	positive("retry max", int64(t.RetryMax))
+	positive("LinkedIn fetch posts", int64(t.LinkedInFetchPosts))
+	positive("LinkedIn max posts", int64(t.LinkedInMaxPosts))
+	positive("article max chars", int64(t.ArticleMaxChars))
+	if t.MaxResults > 500 {
+		errs = append(errs, fmt.Errorf("max results must be at most 500 (the Gmail API limit), got %d", t.MaxResults))
+	}
+	if t.MinTextChars < 0 {
+		errs = append(errs, fmt.Errorf("min text chars must not be negative, got %d", t.MinTextChars))
+	}
+	if t.PerEmailSleep < 0 {
+		errs = append(errs, fmt.Errorf("per-email sleep must not be negative, got %s", t.PerEmailSleep))
+	}
+	if t.BackoffMin <= 0 {
+		errs = append(errs, fmt.Errorf("backoff min must be positive, got %s", t.BackoffMin))
+	}
+	if t.BackoffMax < t.BackoffMin {
+		errs = append(errs, fmt.Errorf("backoff max %s is shorter than backoff min %s", t.BackoffMax, t.BackoffMin))
+	}
+	if t.LinkedInMaxPosts > t.LinkedInFetchPosts {
+		errs = append(errs, fmt.Errorf("LinkedIn max posts %d exceeds the %d posts fetched", t.LinkedInMaxPosts, t.LinkedInFetchPosts))
+	}
+	if t.LinkedInMaxAge <= 0 {
+		errs = append(errs, fmt.Errorf("LinkedIn max age must be positive, got %s", t.LinkedInMaxAge))
+	}
+	return errors.Join(errs...)
+}
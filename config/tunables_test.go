@@ -0,0 +1,73 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTunables(t *testing.T) {
+	path := writeConfigFile(t, `
+to_email: me@example.com
+retry_max: 3
+linkedin_max_age: 72h
+profiles:
+  - name: product
+    per_email_sleep: 0s
+    linkedin_max_posts: 5
+  - name: arch
+`)
+	t.Setenv("BACKOFF_MAX", "10s")
+	t.Setenv("PROFILE_ARCH_MIN_TEXT_CHARS", "200")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	if cfg.RetryMax != 3 || cfg.LinkedInMaxAge != 72*time.Hour || cfg.BackoffMax != 10*time.Second {
+		t.Errorf("Top-level tunables not applied: %+v", cfg.Tunables)
+	}
+	if cfg.ArticleMaxChars != ArticleMaxChars || cfg.MinTextChars != MinTextChars {
+		t.Errorf("Expected unset tunables to keep their defaults: %+v", cfg.Tunables)
+	}
+
+	profiles := cfg.ProfileConfigs()
+	product, arch := profiles[0], profiles[1]
+	if product.PerEmailSleep != 0 || product.LinkedInMaxPosts != 5 || product.RetryMax != 3 {
+		t.Errorf("Unexpected product tunables: %+v", product.Tunables)
+	}
+	if arch.MinTextChars != 200 || arch.PerEmailSleep != PerEmailSleep {
+		t.Errorf("Unexpected arch tunables: %+v", arch.Tunables)
+	}
+}
+
+func TestValidateTunables(t *testing.T) {
+	t.Setenv("TO_EMAIL", "me@example.com")
+	t.Setenv("RETRY_MAX", "0")
+	t.Setenv("BACKOFF_MIN", "10s")
+	t.Setenv("LINKEDIN_MAX_POSTS", "20")
+	t.Setenv("LINKEDIN_MAX_AGE", "a week")
+
+	cfg, err := Load("")
+	if err == nil || !strings.Contains(err.Error(), `LINKEDIN_MAX_AGE: invalid duration "a week"`) {
+		t.Errorf("Expected invalid duration to be reported, got %v", err)
+	}
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected Validate to fail")
+	}
+	for _, want := range []string{
+		"retry max must be positive",
+		"backoff max 6s is shorter than backoff min 10s",
+		"LinkedIn max posts 20 exceeds the 15 posts fetched",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected problem %q, got: %v", want, err)
+		}
+	}
+}
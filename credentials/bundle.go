@@ -0,0 +1,219 @@
+package credentials
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	bundleVersion = 1
+	bundlePurpose = "credentials bundle"
+)
+
+// Bundle is the content of an exported credential store. On disk it is
+// encrypted like the store files, under its own passphrase.
+type Bundle struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Host      string    `json:"host"`
+	Contents
+	Checksum string `json:"checksum"` // hex SHA-256 of the JSON of Contents
+}
+
+// Contents are the store files held by a bundle
+type Contents struct {
+	Credentials    json.RawMessage   `json:"credentials,omitempty"`
+	ServiceAccount json.RawMessage   `json:"service_account,omitempty"`
+	Tokens         json.RawMessage   `json:"tokens,omitempty"`      // token.enc, a token for each scope set
+	Token          *oauth2.Token     `json:"token,omitempty"`       // the single token of older bundles
+	TokenScope     string            `json:"token_scope,omitempty"` // scopes granted to Token
+	Secrets        map[string]string `json:"secrets,omitempty"`
+}
+
+func (c *Contents) checksum() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("marshal bundle contents: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Export returns the credentials, token, service account key and stored
+// secrets as a bundle encrypted with passphrase. Every store file must
+// decrypt.
+func (s *Store) Export(passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("bundle passphrase is empty")
+	}
+
+	l, err := s.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Release()
+
+	var c Contents
+	if s.exists("credentials.enc") {
+		if c.Credentials, err = s.loadCredentials(); err != nil {
+			return nil, err
+		}
+	}
+	if s.exists("token.enc") {
+		tokens, err := s.loadTokens()
+		if err != nil {
+			return nil, err
+		}
+		if c.Tokens, err = marshalTokens(tokens); err != nil {
+			return nil, err
+		}
+	}
+	if s.exists(serviceAccountFile) {
+		if c.ServiceAccount, err = s.loadServiceAccount(); err != nil {
+			return nil, err
+		}
+	}
+	if c.Credentials == nil && c.ServiceAccount == nil {
+		return nil, fmt.Errorf("no credentials or service account key in %s", s.baseDir)
+	}
+	if c.Secrets, err = s.secrets(); err != nil {
+		return nil, err
+	}
+
+	host, _ := os.Hostname()
+	b := Bundle{Version: bundleVersion, CreatedAt: time.Now().UTC(), Host: host, Contents: c}
+	if b.Checksum, err = c.checksum(); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("marshal bundle: %w", err)
+	}
+	return seal(passphrase, bundlePurpose, defaultKDF, data)
+}
+
+// OpenBundle decrypts and checks a bundle written by Export
+func OpenBundle(data []byte, passphrase string) (*Bundle, error) {
+	if !isEnvelope(data) {
+		return nil, errors.New("not a credentials bundle")
+	}
+	plaintext, err := open(passphrase, bundlePurpose, data)
+	if err != nil {
+		return nil, fmt.Errorf("open bundle: %w", err)
+	}
+
+	var b Bundle
+	if err := json.Unmarshal(plaintext, &b); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if b.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	sum, err := b.Contents.checksum()
+	if err != nil {
+		return nil, err
+	}
+	if sum != b.Checksum {
+		return nil, errors.New("bundle checksum mismatch")
+	}
+	if len(b.Credentials) == 0 && len(b.ServiceAccount) == 0 {
+		return nil, errors.New("bundle holds no credentials or service account key")
+	}
+	return &b, nil
+}
+
+// Import restores a bundle into the store, encrypting its files with the
+// store's passphrase. Existing store files are only replaced when force is
+// set, and then files missing from the bundle are removed. All files are
+// encrypted before any is replaced, and a failed replacement restores the
+// previous store.
+func (s *Store) Import(b *Bundle, force bool) error {
+	l, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	if !force {
+		for _, name := range storeFiles {
+			if s.exists(name) {
+				return fmt.Errorf("%s already exists in %s; use --force to replace the store", name, s.baseDir)
+			}
+		}
+	}
+
+	steps := []struct {
+		name    string
+		present bool
+		data    func() ([]byte, error)
+	}{
+		{"credentials.enc", len(b.Credentials) > 0, func() ([]byte, error) { return b.Credentials, checkCredentials(b.Credentials) }},
+		{"token.enc", len(b.Tokens) > 0 || b.Token != nil, func() ([]byte, error) { return b.tokenFile() }},
+		{serviceAccountFile, len(b.ServiceAccount) > 0, func() ([]byte, error) {
+			_, err := parseServiceAccountKey(b.ServiceAccount)
+			return b.ServiceAccount, err
+		}},
+		{secretsFile, len(b.Secrets) > 0, func() ([]byte, error) { return json.Marshal(b.Secrets) }},
+	}
+
+	var files []*replacedFile
+	defer func() { discardTemps(files) }()
+
+	for _, step := range steps {
+		path := filepath.Join(s.baseDir, step.name)
+		old, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("read %s: %w", step.name, err)
+		}
+		if err := checkNoBackup(path); err != nil {
+			return err
+		}
+
+		if !step.present {
+			if old != nil {
+				files = append(files, &replacedFile{path: path, old: old, remove: true})
+			}
+			continue
+		}
+		data, err := step.data()
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.name, err)
+		}
+		encrypted, err := s.encrypt(data, step.name)
+		if err != nil {
+			return fmt.Errorf("encrypt %s: %w", step.name, err)
+		}
+		f := &replacedFile{path: path, old: old}
+		files = append(files, f)
+		if f.tmpPath, err = writeTemp(s.baseDir, step.name, encrypted); err != nil {
+			return err
+		}
+	}
+	return replaceFiles(files)
+}
+
+// tokenFile returns the content of token.enc for the bundle
+func (b *Bundle) tokenFile() ([]byte, error) {
+	if len(b.Tokens) == 0 {
+		tok := withScope(b.Token, b.TokenScope)
+		return marshalTokens(map[string]*oauth2.Token{scopeKey(tokenScopes(tok)): tok})
+	}
+	if _, err := parseTokens(b.Tokens); err != nil {
+		return nil, err
+	}
+	return b.Tokens, nil
+}
+
+// exists reports whether the store holds the file name
+func (s *Store) exists(name string) bool {
+	_, err := os.Stat(filepath.Join(s.baseDir, name))
+	return err == nil
+}
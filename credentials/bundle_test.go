@@ -0,0 +1,126 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestExportImport(t *testing.T) {
+	src := newTestStore(t, t.TempDir(), "old-server")
+	creds := []byte(`{"installed":{"client_id":"id"}}`)
+	if err := src.StoreCredentials(creds); err != nil {
+		t.Fatalf("StoreCredentials failed: %v", err)
+	}
+	if err := src.StoreToken(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+	if err := src.SetSecret("ANTHROPIC_API_KEY", "sk-1"); err != nil {
+		t.Fatalf("SetSecret failed: %v", err)
+	}
+
+	data, err := src.Export("bundle-pass")
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if bytes.Contains(data, []byte("refresh")) {
+		t.Error("bundle holds the token in plain text")
+	}
+
+	if _, err := OpenBundle(data, "wrong"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("OpenBundle with a wrong passphrase = %v, want ErrDecrypt", err)
+	}
+	b, err := OpenBundle(data, "bundle-pass")
+	if err != nil {
+		t.Fatalf("OpenBundle failed: %v", err)
+	}
+	if b.CreatedAt.IsZero() || b.Checksum == "" {
+		t.Errorf("bundle metadata missing: %+v", b)
+	}
+
+	dst := newTestStore(t, t.TempDir(), "new-server")
+	if err := dst.Import(b, false); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if got, err := dst.LoadCredentials(); err != nil || !bytes.Equal(got, creds) {
+		t.Errorf("LoadCredentials = %s, %v", got, err)
+	}
+	if tok, err := dst.LoadToken(); err != nil || tok.RefreshToken != "refresh" {
+		t.Errorf("LoadToken = %+v, %v", tok, err)
+	}
+	if v, err := dst.GetSecret("ANTHROPIC_API_KEY"); err != nil || v != "sk-1" {
+		t.Errorf("GetSecret = %q, %v", v, err)
+	}
+
+	// An existing store is only replaced with force
+	if err := dst.Import(b, false); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("Import over an existing store = %v, want a refusal", err)
+	}
+	b.Tokens, b.Secrets = nil, nil
+	if err := dst.Import(b, true); err != nil {
+		t.Fatalf("Import with force failed: %v", err)
+	}
+	if _, err := dst.LoadToken(); err == nil {
+		t.Error("token.enc kept although the forced bundle holds no token")
+	}
+	// Older bundles hold a single token
+	b.Token = &oauth2.Token{AccessToken: "access", RefreshToken: "legacy"}
+	if err := dst.Import(b, true); err != nil {
+		t.Fatalf("Import of a single token failed: %v", err)
+	}
+	if tok, err := dst.LoadToken(); err != nil || tok.RefreshToken != "legacy" {
+		t.Errorf("LoadToken after importing a single token = %+v, %v", tok, err)
+	}
+}
+
+func TestOpenBundleChecksMismatch(t *testing.T) {
+	c := Contents{Credentials: json.RawMessage(`{"installed":{}}`)}
+	data, err := json.Marshal(Bundle{Version: bundleVersion, Contents: c, Checksum: "0000"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	sealed, err := seal("pass", bundlePurpose, defaultKDF, data)
+	if err != nil {
+		t.Fatalf("seal failed: %v", err)
+	}
+	if _, err := OpenBundle(sealed, "pass"); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("OpenBundle error = %v, want a checksum mismatch", err)
+	}
+
+	// Store files are not bundles
+	store := newTestStore(t, t.TempDir(), "pass")
+	token, _ := store.encrypt([]byte(`{}`), "token.enc")
+	if _, err := OpenBundle(token, "pass"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("OpenBundle of a store file = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestImportKeepsStoreOnFailure(t *testing.T) {
+	store := newTestStore(t, t.TempDir(), "pass")
+	if err := store.StoreCredentials([]byte(`{"installed":{"client_id":"old"}}`)); err != nil {
+		t.Fatalf("StoreCredentials failed: %v", err)
+	}
+	if err := store.StoreToken(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+
+	// The service account key is checked only after the credentials were
+	// encrypted, but nothing is replaced before every file is ready
+	b := &Bundle{Contents: Contents{
+		Credentials:    json.RawMessage(`{"installed":{"client_id":"new"}}`),
+		ServiceAccount: json.RawMessage(`{"type":"authorized_user"}`),
+	}}
+	if err := store.Import(b, true); err == nil {
+		t.Fatal("Import of an invalid service account key succeeded")
+	}
+	if got, err := store.LoadCredentials(); err != nil || !strings.Contains(string(got), "old") {
+		t.Errorf("LoadCredentials after a failed import = %s, %v, want the old credentials", got, err)
+	}
+	if _, err := store.LoadToken(); err != nil {
+		t.Errorf("token.enc lost in a failed import: %v", err)
+	}
+}
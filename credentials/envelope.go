@@ -0,0 +1,232 @@
+package credentials
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted files start with a header naming the format version and the key
+// derivation, so that its parameters can be raised later:
+//
+//	magic "NDSE" | version | KDF id | KDF parameters | salt length | salt
+//
+// followed by the GCM nonce and ciphertext. The header and the purpose of the
+// file (its name) are authenticated as additional data, so one encrypted file
+// cannot stand in for another. Files without the magic, or that fail to open
+// as an envelope, are in the legacy layout: salt (16) | nonce | ciphertext,
+// PBKDF2-SHA256 with 100k iterations and no additional data.
+var envelopeMagic = []byte("NDSE")
+
+const envelopeVersion = 1
+
+// Key derivation functions
+const (
+	kdfPBKDF2   byte = 1 // PBKDF2-SHA256; parameter: iterations
+	kdfArgon2id byte = 2 // parameters: time, memory (KiB), threads
+)
+
+// kdfParams select and tune the key derivation
+type kdfParams struct {
+	id         byte
+	iterations uint32 // PBKDF2
+	time       uint32 // Argon2id passes
+	memory     uint32 // Argon2id memory in KiB
+	threads    uint8  // Argon2id parallelism
+}
+
+// defaultKDF is used for every write: Argon2id with the second recommended
+// setting of RFC 9106
+var defaultKDF = kdfParams{id: kdfArgon2id, time: 3, memory: 64 * 1024, threads: 4}
+
+// legacyKDF is the key derivation of files without a header
+var legacyKDF = kdfParams{id: kdfPBKDF2, iterations: 100000}
+
+// Bounds on the parameters read from a file, which would otherwise let a
+// crafted file make decryption take arbitrary time or memory
+const (
+	maxPBKDF2Iterations = 10_000_000
+	maxArgon2Time       = 16
+	maxArgon2Memory     = 1024 * 1024 // 1 GiB
+)
+
+const (
+	saltSize = 16
+	keySize  = 32
+)
+
+func (p kdfParams) deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	switch p.id {
+	case kdfPBKDF2:
+		if p.iterations == 0 || p.iterations > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("unsupported PBKDF2 iterations %d", p.iterations)
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, int(p.iterations), keySize, sha256.New), nil
+	case kdfArgon2id:
+		if p.time == 0 || p.time > maxArgon2Time || p.memory == 0 || p.memory > maxArgon2Memory || p.threads == 0 {
+			return nil, fmt.Errorf("unsupported Argon2id parameters t=%d m=%d p=%d", p.time, p.memory, p.threads)
+		}
+		return argon2.IDKey([]byte(passphrase), salt, p.time, p.memory, p.threads, keySize), nil
+	}
+	return nil, fmt.Errorf("unknown key derivation %d", p.id)
+}
+
+// header encodes the envelope header
+func (p kdfParams) header(salt []byte) []byte {
+	h := append([]byte{}, envelopeMagic...)
+	h = append(h, envelopeVersion, p.id)
+	switch p.id {
+	case kdfPBKDF2:
+		h = binary.BigEndian.AppendUint32(h, p.iterations)
+	case kdfArgon2id:
+		h = binary.BigEndian.AppendUint32(h, p.time)
+		h = binary.BigEndian.AppendUint32(h, p.memory)
+		h = append(h, p.threads)
+	}
+	h = append(h, byte(len(salt)))
+	return append(h, salt...)
+}
+
+// parseHeader splits an enveloped file into its header, the KDF parameters
+// and salt it holds, and the rest
+func parseHeader(data []byte) (header []byte, p kdfParams, salt, rest []byte, err error) {
+	r := data[len(envelopeMagic):]
+	next := func(n int) []byte {
+		if err != nil || len(r) < n {
+			err = errors.New("truncated header")
+			return make([]byte, n)
+		}
+		b := r[:n]
+		r = r[n:]
+		return b
+	}
+
+	if v := next(1)[0]; err == nil && v != envelopeVersion {
+		return nil, p, nil, nil, fmt.Errorf("unsupported format version %d", v)
+	}
+	p.id = next(1)[0]
+	switch p.id {
+	case kdfPBKDF2:
+		p.iterations = binary.BigEndian.Uint32(next(4))
+	case kdfArgon2id:
+		p.time = binary.BigEndian.Uint32(next(4))
+		p.memory = binary.BigEndian.Uint32(next(4))
+		p.threads = next(1)[0]
+	default:
+		if err == nil {
+			err = fmt.Errorf("unknown key derivation %d", p.id)
+		}
+	}
+	salt = next(int(next(1)[0]))
+	if err != nil {
+		return nil, p, nil, nil, fmt.Errorf("invalid encrypted data: %w", err)
+	}
+	return data[:len(data)-len(r)], p, salt, r, nil
+}
+
+// seal encrypts data for purpose under a fresh salt and nonce
+func seal(passphrase, purpose string, p kdfParams, data []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	key, err := p.deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	header := p.header(salt)
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, data, additionalData(header, purpose)), nil
+}
+
+// open decrypts an enveloped or legacy file written for purpose
+func open(passphrase, purpose string, data []byte) ([]byte, error) {
+	if !isEnvelope(data) {
+		return openLegacy(passphrase, data)
+	}
+	plaintext, err := openEnvelope(passphrase, purpose, data)
+	if err != nil {
+		// The salt of a legacy file may happen to start with the magic
+		if legacy, legacyErr := openLegacy(passphrase, data); legacyErr == nil {
+			return legacy, nil
+		}
+	}
+	return plaintext, err
+}
+
+func openEnvelope(passphrase, purpose string, data []byte) ([]byte, error) {
+	header, p, salt, rest, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	return openGCM(passphrase, p, salt, rest, additionalData(header, purpose))
+}
+
+func openLegacy(passphrase string, data []byte) ([]byte, error) {
+	if len(data) < saltSize {
+		return nil, errors.New("invalid encrypted data")
+	}
+	return openGCM(passphrase, legacyKDF, data[:saltSize], data[saltSize:], nil)
+}
+
+// openGCM decrypts nonce | ciphertext under the key derived from salt
+func openGCM(passphrase string, p kdfParams, salt, rest, aad []byte) ([]byte, error) {
+	key, err := p.deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", ErrDecrypt)
+	}
+	return plaintext, nil
+}
+
+// isEnvelope reports whether data starts with the envelope header rather than
+// a legacy salt. A legacy salt matches the magic with probability 2^-32, so
+// open falls back to the legacy layout when the envelope fails.
+func isEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+func additionalData(header []byte, purpose string) []byte {
+	return append(append([]byte{}, header...), purpose...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create GCM: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,118 @@
+package credentials
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/oauth2"
+)
+
+// legacySeal encrypts data in the layout written before the envelope
+func legacySeal(t *testing.T, passphrase string, data []byte) []byte {
+	t.Helper()
+	salt := make([]byte, saltSize)
+	rand.Read(salt)
+	return legacySealSalt(t, passphrase, salt, data)
+}
+
+func legacySealSalt(t *testing.T, passphrase string, salt, data []byte) []byte {
+	t.Helper()
+	gcm, err := newGCM(pbkdf2.Key([]byte(passphrase), salt, 100000, keySize, sha256.New))
+	if err != nil {
+		t.Fatalf("newGCM failed: %v", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	return append(salt, gcm.Seal(nonce, nonce, data, nil)...)
+}
+
+func TestEnvelopeFormat(t *testing.T) {
+	sealed, err := seal("pass", "token.enc", defaultKDF, []byte("secret"))
+	if err != nil {
+		t.Fatalf("seal failed: %v", err)
+	}
+	if !bytes.HasPrefix(sealed, envelopeMagic) || sealed[4] != envelopeVersion || sealed[5] != kdfArgon2id {
+		t.Errorf("sealed data does not start with the Argon2id envelope header: % x", sealed[:6])
+	}
+
+	got, err := open("pass", "token.enc", sealed)
+	if err != nil || string(got) != "secret" {
+		t.Fatalf("open = %q, %v", got, err)
+	}
+	if _, err := open("pass", "credentials.enc", sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("open for another purpose = %v, want ErrDecrypt", err)
+	}
+
+	// The header is authenticated: lowering a parameter breaks decryption
+	tampered := bytes.Clone(sealed)
+	tampered[9]-- // low byte of the Argon2id time parameter
+	if _, err := open("pass", "token.enc", tampered); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("open of a tampered header = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestEnvelopeRejectsUnsupportedHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"truncated", append(bytes.Clone(envelopeMagic), envelopeVersion, kdfArgon2id, 0)},
+		{"version", append(bytes.Clone(envelopeMagic), 9, kdfArgon2id)},
+		{"kdf", append(bytes.Clone(envelopeMagic), envelopeVersion, 7)},
+		{"memory", kdfParams{id: kdfArgon2id, time: 1, memory: maxArgon2Memory + 1, threads: 1}.header(make([]byte, saltSize))},
+		{"iterations", kdfParams{id: kdfPBKDF2, iterations: maxPBKDF2Iterations + 1}.header(make([]byte, saltSize))},
+	} {
+		if _, err := open("pass", "x", tt.data); err == nil || errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: open error = %v, want a format error", tt.name, err)
+		}
+	}
+}
+
+func TestLegacySaltLikeMagic(t *testing.T) {
+	salt := append(bytes.Clone(envelopeMagic), make([]byte, saltSize-len(envelopeMagic))...)
+	for _, second := range []byte{envelopeVersion, 9} {
+		salt[len(envelopeMagic)] = second
+		legacy := legacySealSalt(t, "pass", salt, []byte("secret"))
+		if got, err := open("pass", "token.enc", legacy); err != nil || string(got) != "secret" {
+			t.Errorf("open of a legacy file with salt % x = %q, %v", salt[:6], got, err)
+		}
+		if _, err := open("wrong", "token.enc", legacy); err == nil {
+			t.Errorf("open of a legacy file with salt % x succeeded with a wrong passphrase", salt[:6])
+		}
+	}
+}
+
+func TestLegacyFilesAreReadAndMigrated(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir, "pass")
+	tokenPath := filepath.Join(dir, "token.enc")
+	legacy := legacySeal(t, "pass", []byte(`{"access_token":"old","refresh_token":"refresh"}`))
+	if err := os.WriteFile(tokenPath, legacy, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	tok, err := store.LoadToken()
+	if err != nil {
+		t.Fatalf("LoadToken of a legacy file failed: %v", err)
+	}
+	if tok.AccessToken != "old" {
+		t.Errorf("AccessToken = %q, want old", tok.AccessToken)
+	}
+
+	if err := store.StoreToken(&oauth2.Token{AccessToken: "new", RefreshToken: tok.RefreshToken}); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+	data, _ := os.ReadFile(tokenPath)
+	if !isEnvelope(data) {
+		t.Error("token.enc still in the legacy layout after a write")
+	}
+	if tok, err := store.LoadToken(); err != nil || tok.AccessToken != "new" {
+		t.Errorf("LoadToken after migration = %+v, %v", tok, err)
+	}
+}
@@ -0,0 +1,101 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// TokenStatus describes the stored OAuth token
+type TokenStatus struct {
+	Expiry     time.Time
+	Refreshed  bool     // the stored access token had expired and was refreshed for the check
+	HasRefresh bool     // a refresh token is stored
+	Scopes     []string // scopes granted to the access token
+
+	token *oauth2.Token // the inspected token, refreshed in memory if it had expired
+}
+
+// Client returns an HTTP client authorized with the inspected token. The
+// token is never refreshed again or written to the store.
+func (st *TokenStatus) Client(ctx context.Context) *http.Client {
+	return oauth2.NewClient(ctx, oauth2.StaticTokenSource(st.token))
+}
+
+// InspectToken loads the token stored for scopes (by default all the app
+// uses), refreshes it in memory if it has expired, and asks Google which
+// scopes it grants. The stored token is not
+// modified and no interactive authorization is attempted. If only the scope
+// lookup fails, the status is returned together with the error.
+func (s *Store) InspectToken(ctx context.Context, scopes ...string) (*TokenStatus, error) {
+	credData, err := s.LoadCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("load credentials: %w", err)
+	}
+
+	config, err := google.ConfigFromJSON(credData)
+	if err != nil {
+		return nil, fmt.Errorf("parse credentials: %w", err)
+	}
+
+	tok, err := s.LoadToken(scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TokenStatus{Expiry: tok.Expiry, HasRefresh: tok.RefreshToken != ""}
+	if !tok.Valid() {
+		tok, err = config.TokenSource(ctx, tok).Token()
+		if isInvalidGrant(err) {
+			return nil, fmt.Errorf("refresh token: %w", ErrReauthorize)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("refresh token: %w", err)
+		}
+		status.Refreshed = true
+		status.Expiry = tok.Expiry
+	}
+
+	status.token = tok
+	status.Scopes, err = grantedScopes(ctx, tok)
+	if err != nil {
+		return status, err
+	}
+	return status, nil
+}
+
+// grantedScopes queries Google's tokeninfo endpoint for the scopes of tok
+func grantedScopes(ctx context.Context, tok *oauth2.Token) ([]string, error) {
+	reqURL := tokenInfoURL + "?access_token=" + url.QueryEscape(tok.AccessToken)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tokeninfo request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tokeninfo status %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Scope string `json:"scope"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("parse tokeninfo: %w", err)
+	}
+	return strings.Fields(info.Scope), nil
+}
@@ -0,0 +1,240 @@
+package credentials
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultAuthTimeout bounds how long authorization waits for the user
+const DefaultAuthTimeout = 5 * time.Minute
+
+// exchangeTimeout bounds the exchange of the authorization code for a token
+const exchangeTimeout = 30 * time.Second
+
+// AuthOptions control the interactive OAuth authorization
+type AuthOptions struct {
+	// Headless prints instructions for authorizing on another machine and
+	// reads the redirect URL from In, instead of listening for the redirect
+	Headless bool
+	Timeout  time.Duration // 0 means DefaultAuthTimeout
+	In       io.Reader     // defaults to os.Stdin
+	Out      io.Writer     // defaults to os.Stdout
+}
+
+func (o AuthOptions) withDefaults() AuthOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultAuthTimeout
+	}
+	if o.In == nil {
+		o.In = os.Stdin
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	return o
+}
+
+// Authorize asks the user to grant access to Gmail and stores the resulting
+// token, replacing the stored tokens of every scope set
+func (s *Store) Authorize(ctx context.Context, opts AuthOptions, scopes ...string) error {
+	credData, err := s.LoadCredentials()
+	if err != nil {
+		return fmt.Errorf("load credentials: %w", err)
+	}
+
+	config, err := google.ConfigFromJSON(credData, withDefaultScopes(scopes)...)
+	if err != nil {
+		return fmt.Errorf("parse credentials: %w", err)
+	}
+
+	tok, err := authorize(ctx, config, opts)
+	if err != nil {
+		return err
+	}
+
+	l, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	if err := s.storeTokens(map[string]*oauth2.Token{scopeKey(config.Scopes): tok}); err != nil {
+		return fmt.Errorf("store new token: %w", err)
+	}
+	return nil
+}
+
+// authorize runs the authorization code flow with PKCE against a redirect to
+// 127.0.0.1. The state sent with the request is checked on the redirect.
+func authorize(ctx context.Context, config *oauth2.Config, opts AuthOptions) (*oauth2.Token, error) {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	// Listen even when headless: the redirect URI needs a port, and a
+	// forwarded port (ssh -L) still completes the flow on its own
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen for OAuth redirect: %w", err)
+	}
+	defer ln.Close()
+
+	cfg := *config
+	cfg.RedirectURL = fmt.Sprintf("http://%s/", ln.Addr())
+	authURL := cfg.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+
+	codes := make(chan authResult, 1)
+	srv := &http.Server{Handler: redirectHandler(state, codes), ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	if opts.Headless {
+		port := ln.Addr().(*net.TCPAddr).Port
+		fmt.Fprintf(opts.Out, `Open this URL in a browser on any machine:
+
+  %s
+
+After you approve access, the browser is sent to %s, which fails to
+load unless that machine can reach this one (e.g. ssh -L %d:127.0.0.1:%d).
+Copy the full address from the browser's address bar and paste it here.
+
+Redirect URL: `, authURL, cfg.RedirectURL, port, port)
+		go readRedirect(opts.In, state, codes)
+	} else {
+		fmt.Fprintf(opts.Out, "Open this URL in your browser to authorize access:\n\n  %s\n\nWaiting for the authorization on %s (up to %s)...\n", authURL, cfg.RedirectURL, opts.Timeout)
+	}
+
+	var code string
+	select {
+	case r := <-codes:
+		if r.err != nil {
+			return nil, r.err
+		}
+		code = r.code
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("authorization timed out after %s", opts.Timeout)
+		}
+		return nil, ctx.Err()
+	}
+
+	exchangeCtx, cancelExchange := context.WithTimeout(context.WithoutCancel(ctx), exchangeTimeout)
+	defer cancelExchange()
+
+	token, err := cfg.Exchange(exchangeCtx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange authorization code: %w", err)
+	}
+	// Google reports the granted scopes, which may be fewer than requested
+	if tokenScope(token) == "" {
+		token = withScope(token, strings.Join(cfg.Scopes, " "))
+	}
+	return token, nil
+}
+
+type authResult struct {
+	code string
+	err  error
+}
+
+// redirectHandler receives the authorization redirect. Requests whose state
+// does not match are rejected without ending the flow.
+func redirectHandler(state string, codes chan<- authResult) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		res, err := parseRedirect(r.URL.Query(), state)
+		if err != nil && res.err == nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if res.err != nil {
+			fmt.Fprintf(w, "<p>Authorization failed: %s</p><p>You can close this window.</p>", html.EscapeString(res.err.Error()))
+		} else {
+			fmt.Fprint(w, "<p>Authorization complete. You can close this window.</p>")
+		}
+		deliver(codes, res)
+	})
+}
+
+// readRedirect reads the redirect URL pasted in headless mode
+func readRedirect(in io.Reader, state string, codes chan<- authResult) {
+	line, err := bufio.NewReader(in).ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		deliver(codes, authResult{err: fmt.Errorf("read redirect URL: %w", err)})
+		return
+	}
+
+	u, err := url.Parse(line)
+	if err != nil {
+		deliver(codes, authResult{err: fmt.Errorf("invalid redirect URL: %w", err)})
+		return
+	}
+	res, err := parseRedirect(u.Query(), state)
+	if err != nil && res.err == nil {
+		res.err = err
+	}
+	deliver(codes, res)
+}
+
+// deliver passes on the first result; later ones are dropped
+func deliver(codes chan<- authResult, res authResult) {
+	select {
+	case codes <- res:
+	default:
+	}
+}
+
+// parseRedirect checks the query of an authorization redirect. A result with
+// an error ends the flow; an error alone means the request was not a
+// redirect for this flow.
+func parseRedirect(q url.Values, state string) (authResult, error) {
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state)) != 1 {
+		return authResult{}, errors.New("state mismatch: the redirect does not belong to this authorization")
+	}
+	if e := q.Get("error"); e != "" {
+		return authResult{err: fmt.Errorf("authorization denied: %s", e)}, nil
+	}
+	code := q.Get("code")
+	if code == "" {
+		return authResult{}, errors.New("redirect has no authorization code")
+	}
+	return authResult{code: code}, nil
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate state token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
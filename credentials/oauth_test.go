@@ -0,0 +1,167 @@
+package credentials
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenServer is a token endpoint that checks the PKCE verifier against the
+// challenge of the authorization URL
+func tokenServer(t *testing.T, challenge *string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("ParseForm failed: %v", err)
+		}
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if got := base64.RawURLEncoding.EncodeToString(sum[:]); got != *challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("code") != "the-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// authURLFrom reads output until it finds the authorization URL and returns
+// its query
+func authURLFrom(t *testing.T, out io.Reader) url.Values {
+	t.Helper()
+	sc := bufio.NewScanner(out)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); strings.HasPrefix(line, "https://auth.example/") {
+			u, err := url.Parse(line)
+			if err != nil {
+				t.Fatalf("parse auth URL failed: %v", err)
+			}
+			go io.Copy(io.Discard, out)
+			return u.Query()
+		}
+	}
+	t.Fatal("no authorization URL printed")
+	return nil
+}
+
+func testOAuthConfig(tokenURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{AuthURL: "https://auth.example/auth", TokenURL: tokenURL},
+		Scopes:   []string{"scope"},
+	}
+}
+
+func TestAuthorizeLoopback(t *testing.T) {
+	var challenge string
+	srv := tokenServer(t, &challenge)
+	outR, outW := io.Pipe()
+
+	done := make(chan struct{})
+	var tok *oauth2.Token
+	var err error
+	go func() {
+		defer close(done)
+		tok, err = authorize(context.Background(), testOAuthConfig(srv.URL), AuthOptions{Timeout: 10 * time.Second, Out: outW})
+		outW.Close()
+	}()
+
+	q := authURLFrom(t, outR)
+	challenge = q.Get("code_challenge")
+	if q.Get("code_challenge_method") != "S256" || challenge == "" {
+		t.Fatalf("auth URL has no S256 challenge: %v", q)
+	}
+	if q.Has("include_granted_scopes") {
+		t.Errorf("auth URL asks to include the scopes granted before: %v", q)
+	}
+	redirect := q.Get("redirect_uri")
+	if !strings.HasPrefix(redirect, "http://127.0.0.1:") {
+		t.Fatalf("redirect_uri = %q, want a 127.0.0.1 loopback", redirect)
+	}
+
+	// A redirect with the wrong state is rejected and the flow keeps waiting
+	resp, getErr := http.Get(redirect + "?code=evil&state=wrong")
+	if getErr != nil {
+		t.Fatalf("GET failed: %v", getErr)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("wrong state status = %d, want 400", resp.StatusCode)
+	}
+
+	resp, getErr = http.Get(redirect + "?code=the-code&state=" + url.QueryEscape(q.Get("state")))
+	if getErr != nil {
+		t.Fatalf("GET failed: %v", getErr)
+	}
+	resp.Body.Close()
+
+	<-done
+	if err != nil {
+		t.Fatalf("authorize failed: %v", err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" {
+		t.Errorf("token = %+v", tok)
+	}
+}
+
+func TestAuthorizeHeadless(t *testing.T) {
+	var challenge string
+	srv := tokenServer(t, &challenge)
+
+	for _, tt := range []struct {
+		name    string
+		state   func(want string) string
+		wantErr string
+	}{
+		{"valid", func(want string) string { return want }, ""},
+		{"state mismatch", func(string) string { return "forged" }, "state mismatch"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			outR, outW := io.Pipe()
+			inR, inW := io.Pipe()
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := authorize(context.Background(), testOAuthConfig(srv.URL), AuthOptions{Headless: true, Timeout: 10 * time.Second, In: inR, Out: outW})
+				outW.Close()
+				done <- err
+			}()
+
+			q := authURLFrom(t, outR)
+			challenge = q.Get("code_challenge")
+			pasted := q.Get("redirect_uri") + "?state=" + url.QueryEscape(tt.state(q.Get("state"))) + "&code=the-code&scope=scope\n"
+			io.WriteString(inW, pasted)
+
+			err := <-done
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("authorize failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("authorize error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTimeout(t *testing.T) {
+	_, err := authorize(context.Background(), testOAuthConfig("http://127.0.0.1:1/token"), AuthOptions{Timeout: 50 * time.Millisecond, Out: io.Discard})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("authorize error = %v, want a timeout", err)
+	}
+}
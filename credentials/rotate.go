@@ -0,0 +1,163 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// replacedFile is a store file being re-encrypted, replaced or removed
+type replacedFile struct {
+	path    string
+	old     []byte // current encrypted content, kept as the backup; nil when there is none
+	tmpPath string // new content, renamed over path
+	remove  bool   // remove path instead
+}
+
+// Rotate re-encrypts every file of the store with a new passphrase. Every
+// file must decrypt with the current passphrase, or nothing is changed. Each
+// file is replaced by renaming a temporary file over it; the previous files
+// are kept as .bak until all of them have been replaced, and restored if a
+// replacement fails.
+func (s *Store) Rotate(newPassphrase string) error {
+	if newPassphrase == "" {
+		return errors.New("new passphrase is empty")
+	}
+	if newPassphrase == s.passphrase {
+		return errors.New("new passphrase is the same as the current one")
+	}
+	next := &Store{baseDir: s.baseDir, passphrase: newPassphrase}
+
+	l, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	var files []*replacedFile
+	defer func() { discardTemps(files) }()
+
+	for _, name := range storeFiles {
+		path := filepath.Join(s.baseDir, name)
+		encrypted, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		if err := checkNoBackup(path); err != nil {
+			return err
+		}
+
+		plaintext, err := s.decrypt(encrypted, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w; nothing was changed", name, err)
+		}
+		reencrypted, err := next.encrypt(plaintext, name)
+		if err != nil {
+			return fmt.Errorf("encrypt %s: %w", name, err)
+		}
+
+		f := &replacedFile{path: path, old: encrypted}
+		files = append(files, f)
+		if f.tmpPath, err = writeTemp(s.baseDir, name, reencrypted); err != nil {
+			return err
+		}
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("nothing to rotate in %s", s.baseDir)
+	}
+	if err := replaceFiles(files); err != nil {
+		return err
+	}
+	s.passphrase = newPassphrase
+	return nil
+}
+
+// replaceFiles backs up and replaces or removes every file, restoring the
+// backups if a step fails
+func replaceFiles(files []*replacedFile) error {
+	var replaced []*replacedFile
+	rollback := func(err error) error {
+		for _, f := range replaced {
+			if f.old == nil {
+				if rerr := os.Remove(f.path); rerr != nil {
+					err = errors.Join(err, fmt.Errorf("remove new %s: %w", f.path, rerr))
+				}
+				continue
+			}
+			if rerr := os.Rename(f.path+".bak", f.path); rerr != nil {
+				err = errors.Join(err, fmt.Errorf("restore %s from backup: %w", f.path, rerr))
+			}
+		}
+		for _, f := range files {
+			os.Remove(f.path + ".bak")
+		}
+		return err
+	}
+
+	for _, f := range files {
+		if f.old != nil {
+			if err := os.WriteFile(f.path+".bak", f.old, 0600); err != nil {
+				return rollback(fmt.Errorf("back up %s: %w", f.path, err))
+			}
+		}
+		if f.remove {
+			if err := os.Remove(f.path); err != nil {
+				return rollback(fmt.Errorf("remove %s: %w", f.path, err))
+			}
+		} else {
+			if err := os.Rename(f.tmpPath, f.path); err != nil {
+				return rollback(fmt.Errorf("replace %s: %w", f.path, err))
+			}
+			f.tmpPath = ""
+		}
+		replaced = append(replaced, f)
+	}
+
+	for _, f := range files {
+		os.Remove(f.path + ".bak")
+	}
+	return nil
+}
+
+// discardTemps removes the temporary files that were not renamed into place
+func discardTemps(files []*replacedFile) {
+	for _, f := range files {
+		if f.tmpPath != "" {
+			os.Remove(f.tmpPath)
+		}
+	}
+}
+
+// checkNoBackup fails when path has a backup left by an interrupted
+// replacement, which a new one would overwrite
+func checkNoBackup(path string) error {
+	if _, err := os.Stat(path + ".bak"); err == nil {
+		return fmt.Errorf("%s.bak exists from an interrupted rotation or import; restore or remove it first", filepath.Base(path))
+	}
+	return nil
+}
+
+// writeTemp writes data to a new temporary file next to name and syncs it
+func writeTemp(dir, name string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(dir, name+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("create temporary %s: %w", name, err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("write temporary %s: %w", name, err)
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,133 @@
+package credentials
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func newTestStore(t *testing.T, dir, passphrase string) *Store {
+	t.Helper()
+	store, err := NewStore(Config{BaseDir: dir, Passphrase: passphrase})
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	return store
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir, "old-passphrase")
+	creds := []byte(`{"installed":{"client_id":"id"}}`)
+	if err := store.StoreCredentials(creds); err != nil {
+		t.Fatalf("StoreCredentials failed: %v", err)
+	}
+	if err := store.StoreToken(&oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+
+	if err := store.Rotate("new-passphrase"); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+
+	rotated := newTestStore(t, dir, "new-passphrase")
+	got, err := rotated.LoadCredentials()
+	if err != nil || !bytes.Equal(got, creds) {
+		t.Errorf("LoadCredentials after rotation = %s, %v", got, err)
+	}
+	tok, err := rotated.LoadToken()
+	if err != nil || tok.RefreshToken != "refresh" {
+		t.Errorf("LoadToken after rotation = %+v, %v", tok, err)
+	}
+	if _, err := newTestStore(t, dir, "old-passphrase").LoadCredentials(); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("old passphrase still decrypts: %v", err)
+	}
+	if _, err := store.LoadToken(); err != nil {
+		t.Errorf("rotated store does not use the new passphrase: %v", err)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*.*.*"))
+	bak, _ := filepath.Glob(filepath.Join(dir, "*.bak"))
+	if len(leftovers)+len(bak) > 0 {
+		t.Errorf("rotation left files behind: %v %v", leftovers, bak)
+	}
+}
+
+func TestRotateRefusesUndecryptableFile(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir, "old-passphrase")
+	if err := store.StoreCredentials([]byte(`{"installed":{}}`)); err != nil {
+		t.Fatalf("StoreCredentials failed: %v", err)
+	}
+	// A token written under another passphrase
+	if err := newTestStore(t, dir, "other").StoreToken(&oauth2.Token{AccessToken: "a"}); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+	before, _ := os.ReadFile(filepath.Join(dir, "credentials.enc"))
+
+	err := store.Rotate("new-passphrase")
+	if !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("Rotate error = %v, want ErrDecrypt", err)
+	}
+	after, _ := os.ReadFile(filepath.Join(dir, "credentials.enc"))
+	if !bytes.Equal(before, after) {
+		t.Error("credentials.enc changed although rotation was refused")
+	}
+	if _, err := store.LoadCredentials(); err != nil {
+		t.Errorf("LoadCredentials with the old passphrase failed: %v", err)
+	}
+}
+
+func TestRotateWithoutToken(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir, "old-passphrase")
+	if err := store.StoreCredentials([]byte(`{"installed":{}}`)); err != nil {
+		t.Fatalf("StoreCredentials failed: %v", err)
+	}
+	if err := store.Rotate("new-passphrase"); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "token.enc")); !os.IsNotExist(err) {
+		t.Errorf("token.enc created by rotation: %v", err)
+	}
+}
+
+func TestReplaceFilesRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	kept, added := filepath.Join(dir, "a.enc"), filepath.Join(dir, "b.enc")
+	if err := os.WriteFile(kept, []byte("old"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	tmp, err := writeTemp(dir, "a.enc", []byte("new"))
+	if err != nil {
+		t.Fatalf("writeTemp failed: %v", err)
+	}
+	newTmp, err := writeTemp(dir, "b.enc", []byte("new"))
+	if err != nil {
+		t.Fatalf("writeTemp failed: %v", err)
+	}
+
+	// The last rename fails: its temporary file is gone
+	files := []*replacedFile{
+		{path: kept, old: []byte("old"), tmpPath: tmp},
+		{path: added, tmpPath: newTmp},
+		{path: filepath.Join(dir, "c.enc"), tmpPath: filepath.Join(dir, "missing")},
+	}
+	if err := replaceFiles(files); err == nil {
+		t.Fatal("replaceFiles succeeded with a missing temporary file")
+	}
+
+	if data, err := os.ReadFile(kept); err != nil || string(data) != "old" {
+		t.Errorf("a.enc = %q, %v, want the old content restored", data, err)
+	}
+	if _, err := os.Stat(added); !os.IsNotExist(err) {
+		t.Errorf("b.enc left behind by a rolled back replacement: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.bak")); len(matches) > 0 {
+		t.Errorf("backups left behind: %v", matches)
+	}
+}
@@ -0,0 +1,79 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/oauth2"
+	gmail "google.golang.org/api/gmail/v1"
+)
+
+// legacyScopes were requested for every token stored before the granted
+// scopes were recorded
+var legacyScopes = []string{gmail.GmailReadonlyScope, gmail.GmailModifyScope, gmail.GmailSendScope}
+
+// MissingScopesError is returned when the stored token was not granted
+// every scope an operation needs and it cannot be authorized interactively
+type MissingScopesError struct {
+	Scopes []string
+}
+
+func (e *MissingScopesError) Error() string {
+	return fmt.Sprintf("the stored token lacks the scope(s) %s; run the command once from a terminal to grant them, or re-run 'newsletterdigest_go setup'", strings.Join(e.Scopes, ", "))
+}
+
+// MissingScopes returns the scopes of required that the granted ones do not
+// cover. Full mail access covers every Gmail scope, and modify covers
+// read-only access.
+func MissingScopes(granted, required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !scopeCovered(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+func scopeCovered(granted []string, scope string) bool {
+	switch {
+	case slices.Contains(granted, scope), slices.Contains(granted, gmail.MailGoogleComScope):
+		return true
+	case scope == gmail.GmailReadonlyScope:
+		return slices.Contains(granted, gmail.GmailModifyScope)
+	}
+	return false
+}
+
+// tokenScopes returns the scopes granted to tok, as reported by the token
+// endpoint and recorded with the stored token
+func tokenScopes(tok *oauth2.Token) []string {
+	if s := tokenScope(tok); s != "" {
+		return strings.Fields(s)
+	}
+	return legacyScopes
+}
+
+// tokenScope returns the space-separated scopes the token endpoint returned
+// with tok, or ""
+func tokenScope(tok *oauth2.Token) string {
+	s, _ := tok.Extra("scope").(string)
+	return s
+}
+
+// withScope returns tok with its granted scopes recorded
+func withScope(tok *oauth2.Token, scope string) *oauth2.Token {
+	if scope == "" {
+		return tok
+	}
+	return tok.WithExtra(map[string]any{"scope": scope})
+}
+
+// interactive reports whether the user can complete a browser authorization,
+// which needs a terminal to show the URL on
+func interactive() bool {
+	st, err := os.Stdin.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,97 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/oauth2"
+	gmail "google.golang.org/api/gmail/v1"
+)
+
+func TestMissingScopes(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		granted, required []string
+		want              []string
+	}{
+		{"read only", []string{gmail.GmailReadonlyScope}, []string{gmail.GmailReadonlyScope}, nil},
+		{"send missing", []string{gmail.GmailReadonlyScope}, []string{gmail.GmailReadonlyScope, gmail.GmailSendScope}, []string{gmail.GmailSendScope}},
+		{"modify covers read", []string{gmail.GmailModifyScope}, []string{gmail.GmailReadonlyScope, gmail.GmailModifyScope}, nil},
+		{"read does not cover modify", []string{gmail.GmailReadonlyScope}, []string{gmail.GmailModifyScope}, []string{gmail.GmailModifyScope}},
+		{"full mail access", []string{gmail.MailGoogleComScope}, legacyScopes, nil},
+	} {
+		if got := MissingScopes(tt.granted, tt.required); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: MissingScopes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoredTokenScopes(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir, "pass")
+
+	tok := withScope(&oauth2.Token{AccessToken: "a", RefreshToken: "r"}, gmail.GmailReadonlyScope)
+	if err := store.StoreToken(tok); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+	loaded, err := store.LoadToken(gmail.GmailReadonlyScope)
+	if err != nil {
+		t.Fatalf("LoadToken failed: %v", err)
+	}
+	if got := tokenScopes(loaded); !slices.Equal(got, []string{gmail.GmailReadonlyScope}) {
+		t.Errorf("scopes of the loaded token = %v, want read-only", got)
+	}
+	if loaded.RefreshToken != "r" {
+		t.Errorf("RefreshToken = %q, want r", loaded.RefreshToken)
+	}
+
+	// Tokens stored before scopes were recorded were granted every scope
+	legacy, err := store.encrypt([]byte(`{"access_token":"a","refresh_token":"r"}`), "token.enc")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "token.enc"), legacy, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if loaded, err = store.LoadToken(); err != nil {
+		t.Fatalf("LoadToken failed: %v", err)
+	}
+	if got := tokenScopes(loaded); !slices.Equal(got, legacyScopes) {
+		t.Errorf("scopes of a legacy token = %v, want %v", got, legacyScopes)
+	}
+}
+
+func TestTokensPerScopeSet(t *testing.T) {
+	store := newTestStore(t, t.TempDir(), "pass")
+	readOnly := []string{gmail.GmailReadonlyScope}
+
+	if err := store.StoreToken(&oauth2.Token{AccessToken: "full"}, legacyScopes...); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+	if _, err := store.LoadToken(readOnly...); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadToken of read-only scopes = %v, want os.ErrNotExist rather than the broader token", err)
+	}
+
+	if err := store.StoreToken(&oauth2.Token{AccessToken: "read"}, readOnly...); err != nil {
+		t.Fatalf("StoreToken failed: %v", err)
+	}
+	// The order of the scopes does not matter
+	reversed := slices.Clone(legacyScopes)
+	slices.Reverse(reversed)
+	for _, tt := range []struct {
+		scopes []string
+		want   string
+	}{
+		{readOnly, "read"},
+		{legacyScopes, "full"},
+		{reversed, "full"},
+		{nil, "full"},
+	} {
+		if tok, err := store.LoadToken(tt.scopes...); err != nil || tok.AccessToken != tt.want {
+			t.Errorf("LoadToken(%v) = %+v, %v, want %s", tt.scopes, tok, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const serviceAccountFile = "service_account.enc"
+
+// serviceAccountKey holds the fields of a service account key file that are
+// checked before it is stored
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	ClientID    string `json:"client_id"`
+	PrivateKey  string `json:"private_key"`
+}
+
+func parseServiceAccountKey(data []byte) (*serviceAccountKey, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid service account JSON: %w", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("not a service account key (type %q)", key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, errors.New("service account key lacks client_email or private_key")
+	}
+	return &key, nil
+}
+
+// StoreServiceAccount encrypts and stores a service account key
+func (s *Store) StoreServiceAccount(key []byte) error {
+	l, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return s.storeServiceAccount(key)
+}
+
+func (s *Store) storeServiceAccount(key []byte) error {
+	if _, err := parseServiceAccountKey(key); err != nil {
+		return err
+	}
+	return s.writeFile(serviceAccountFile, key)
+}
+
+// LoadServiceAccount decrypts and loads the service account key
+func (s *Store) LoadServiceAccount() ([]byte, error) {
+	l, err := s.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Release()
+	return s.loadServiceAccount()
+}
+
+func (s *Store) loadServiceAccount() ([]byte, error) {
+	encrypted, err := os.ReadFile(filepath.Join(s.baseDir, serviceAccountFile))
+	if err != nil {
+		return nil, fmt.Errorf("read encrypted service account key: %w", err)
+	}
+	decrypted, err := s.decrypt(encrypted, serviceAccountFile)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt service account key: %w", err)
+	}
+	return decrypted, nil
+}
+
+// delegationClient names the client that domain-wide delegation is granted
+// to. Keys without a client_id name the service account instead, whose
+// client ID is shown in the Cloud console.
+func delegationClient(key *serviceAccountKey) string {
+	if key.ClientID == "" {
+		return "the client ID of " + key.ClientEmail
+	}
+	return "client ID " + key.ClientID
+}
+
+// SetupServiceAccountFromFile stores the service account key file at path
+func (s *Store) SetupServiceAccountFromFile(path string) error {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read service account file: %w", err)
+	}
+	return s.StoreServiceAccount(key)
+}
+
+// ServiceAccountClient returns a client authenticated as the stored service
+// account acting for subject, the mailbox it impersonates through
+// domain-wide delegation. A first token is fetched right away, so that a
+// missing delegation fails here rather than on the first Gmail call.
+func (s *Store) ServiceAccountClient(ctx context.Context, subject string, scopes ...string) (*http.Client, error) {
+	data, err := s.LoadServiceAccount()
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseServiceAccountKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes = withDefaultScopes(scopes)
+	conf, err := google.JWTConfigFromJSON(data, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("parse service account key: %w", err)
+	}
+	conf.Subject = subject
+
+	ts := conf.TokenSource(ctx)
+	if _, err := ts.Token(); err != nil {
+		var re *oauth2.RetrieveError
+		if errors.As(err, &re) && (re.ErrorCode == "unauthorized_client" || re.ErrorCode == "access_denied") {
+			return nil, fmt.Errorf("impersonate %s: %w; in the Google Workspace admin console, grant %s domain-wide delegation for %s",
+				subject, err, delegationClient(key), strings.Join(scopes, ","))
+		}
+		return nil, fmt.Errorf("impersonate %s: %w", subject, err)
+	}
+	return oauth2.NewClient(ctx, ts), nil
+}
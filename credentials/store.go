@@ -3,31 +3,39 @@ package credentials
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/mail"
 	"os"
 	"path/filepath"
-	"time"
+	"slices"
+	"strings"
 
-	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	gmail "google.golang.org/api/gmail/v1"
+
+	"newsletterdigest_go/config"
+	"newsletterdigest_go/lockfile"
 )
 
+// ErrDecrypt is returned when stored data fails authentication, which means
+// the passphrase differs from the one used to encrypt it or the file is damaged
+var ErrDecrypt = errors.New("authentication failed: wrong passphrase or corrupted file")
+
 // Store handles encrypted credential storage
 type Store struct {
 	baseDir    string
 	passphrase string
 }
 
+// storeFiles are the files a store may hold
+var storeFiles = []string{"credentials.enc", "token.enc", secretsFile, serviceAccountFile}
+
+// lockFile serializes access to the store between processes
+const lockFile = "store.lock"
+
 // Config holds configuration for the credential store
 type Config struct {
 	BaseDir    string // Optional: custom storage directory
@@ -64,257 +72,290 @@ func NewStore(cfg Config) (*Store, error) {
 func NewStoreFromEnv() (*Store, error) {
 	cfg := Config{
 		BaseDir:    os.Getenv("CREDENTIALS_DIR"),
-		Passphrase: os.Getenv("CREDENTIALS_PASSPHRASE"),
+		Passphrase: config.Secret("CREDENTIALS_PASSPHRASE"),
 	}
 	return NewStore(cfg)
 }
 
-// deriveKey creates an encryption key from the passphrase
-func (s *Store) deriveKey(salt []byte) []byte {
-	return pbkdf2.Key([]byte(s.passphrase), salt, 100000, 32, sha256.New)
+// encrypt encrypts data using AES-GCM under a key derived with Argon2id. The
+// purpose (the file name) is authenticated along with the data.
+func (s *Store) encrypt(data []byte, purpose string) ([]byte, error) {
+	return seal(s.passphrase, purpose, defaultKDF, data)
 }
 
-// encrypt encrypts data using AES-GCM
-func (s *Store) encrypt(data []byte) ([]byte, error) {
-	// Generate random salt
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return nil, fmt.Errorf("generate salt: %w", err)
-	}
-
-	// Derive key from passphrase and salt
-	key := s.deriveKey(salt)
+// decrypt decrypts data written by encrypt for the same purpose, or in the
+// legacy layout
+func (s *Store) decrypt(data []byte, purpose string) ([]byte, error) {
+	return open(s.passphrase, purpose, data)
+}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+// lock waits for a shared lock on the store, for reading, or an exclusive
+// one, for writing. Exported methods take the lock; the unexported ones they
+// call expect it to be held.
+func (s *Store) lock(shared bool) (*lockfile.Lock, error) {
+	l, err := lockfile.Acquire(filepath.Join(s.baseDir, lockFile), shared)
 	if err != nil {
-		return nil, fmt.Errorf("create cipher: %w", err)
+		return nil, fmt.Errorf("lock credential store: %w", err)
 	}
+	return l, nil
+}
 
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
+// writeFile encrypts data and replaces the store file name by renaming a
+// temporary file over it, so that no reader sees a partial file
+func (s *Store) writeFile(name string, data []byte) error {
+	encrypted, err := s.encrypt(data, name)
 	if err != nil {
-		return nil, fmt.Errorf("create GCM: %w", err)
+		return fmt.Errorf("encrypt %s: %w", name, err)
 	}
-
-	// Generate nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return nil, fmt.Errorf("generate nonce: %w", err)
+	tmp, err := writeTemp(s.baseDir, name, encrypted)
+	if err != nil {
+		return err
 	}
-
-	// Encrypt
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-
-	// Prepend salt to ciphertext
-	result := append(salt, ciphertext...)
-	return result, nil
+	if err := os.Rename(tmp, filepath.Join(s.baseDir, name)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("replace %s: %w", name, err)
+	}
+	return nil
 }
 
-// decrypt decrypts data using AES-GCM
-func (s *Store) decrypt(data []byte) ([]byte, error) {
-	if len(data) < 16 {
-		return nil, errors.New("invalid encrypted data")
+// StoreCredentials encrypts and stores Google OAuth credentials
+func (s *Store) StoreCredentials(credentials []byte) error {
+	l, err := s.lock(false)
+	if err != nil {
+		return err
 	}
+	defer l.Release()
+	return s.storeCredentials(credentials)
+}
 
-	// Extract salt and ciphertext
-	salt := data[:16]
-	ciphertext := data[16:]
+func (s *Store) storeCredentials(credentials []byte) error {
+	if err := checkCredentials(credentials); err != nil {
+		return err
+	}
+	return s.writeFile("credentials.enc", credentials)
+}
 
-	// Derive key
-	key := s.deriveKey(salt)
+// checkCredentials validates the JSON format of Google OAuth credentials
+func checkCredentials(credentials []byte) error {
+	var cred map[string]interface{}
+	if err := json.Unmarshal(credentials, &cred); err != nil {
+		return fmt.Errorf("invalid credentials JSON: %w", err)
+	}
+	return nil
+}
 
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
+// LoadCredentials decrypts and loads Google OAuth credentials
+func (s *Store) LoadCredentials() ([]byte, error) {
+	l, err := s.lock(true)
 	if err != nil {
-		return nil, fmt.Errorf("create cipher: %w", err)
+		return nil, err
 	}
+	defer l.Release()
+	return s.loadCredentials()
+}
 
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
+func (s *Store) loadCredentials() ([]byte, error) {
+	credPath := filepath.Join(s.baseDir, "credentials.enc")
+	encrypted, err := os.ReadFile(credPath)
 	if err != nil {
-		return nil, fmt.Errorf("create GCM: %w", err)
+		return nil, fmt.Errorf("read encrypted credentials: %w", err)
 	}
 
-	// Check minimum length
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, errors.New("ciphertext too short")
+	decrypted, err := s.decrypt(encrypted, "credentials.enc")
+	if err != nil {
+		return nil, fmt.Errorf("decrypt credentials: %w", err)
 	}
 
-	// Extract nonce and actual ciphertext
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	return decrypted, nil
+}
 
-	// Decrypt
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, fmt.Errorf("decrypt: %w", err)
-	}
+// storedToken is a token as stored in token.enc: the token and the scopes
+// granted to it, which the JSON of oauth2.Token leaves out
+type storedToken struct {
+	oauth2.Token
+	Scope string `json:"scope,omitempty"`
+}
 
-	return plaintext, nil
+// tokenFile is the content of token.enc: a token for each set of scopes one
+// was authorized for, keyed by scopeKey. Stores written before tokens were
+// kept per scope set hold a single storedToken instead.
+type tokenFile struct {
+	Tokens map[string]storedToken `json:"tokens"`
 }
 
-// StoreCredentials encrypts and stores Google OAuth credentials
-func (s *Store) StoreCredentials(credentials []byte) error {
-	// Validate JSON format
-	var cred map[string]interface{}
-	if err := json.Unmarshal(credentials, &cred); err != nil {
-		return fmt.Errorf("invalid credentials JSON: %w", err)
-	}
+// scopeKey identifies a set of scopes independently of their order
+func scopeKey(scopes []string) string {
+	return strings.Join(slices.Compact(slices.Sorted(slices.Values(scopes))), " ")
+}
 
-	encrypted, err := s.encrypt(credentials)
+// StoreToken encrypts and stores an OAuth token as the token for scopes, by
+// default the scopes granted to it. Tokens of other scope sets are kept.
+func (s *Store) StoreToken(token *oauth2.Token, scopes ...string) error {
+	l, err := s.lock(false)
 	if err != nil {
-		return fmt.Errorf("encrypt credentials: %w", err)
+		return err
 	}
+	defer l.Release()
 
-	credPath := filepath.Join(s.baseDir, "credentials.enc")
-	if err := os.WriteFile(credPath, encrypted, 0600); err != nil {
-		return fmt.Errorf("write encrypted credentials: %w", err)
+	tokens, err := s.loadTokens()
+	if errors.Is(err, os.ErrNotExist) {
+		tokens = make(map[string]*oauth2.Token)
+	} else if err != nil {
+		return err
 	}
-
-	return nil
+	if len(scopes) == 0 {
+		scopes = tokenScopes(token)
+	}
+	tokens[scopeKey(scopes)] = token
+	return s.storeTokens(tokens)
 }
 
-// LoadCredentials decrypts and loads Google OAuth credentials
-func (s *Store) LoadCredentials() ([]byte, error) {
-	credPath := filepath.Join(s.baseDir, "credentials.enc")
-	encrypted, err := os.ReadFile(credPath)
+func (s *Store) storeTokens(tokens map[string]*oauth2.Token) error {
+	tokenData, err := marshalTokens(tokens)
 	if err != nil {
-		return nil, fmt.Errorf("read encrypted credentials: %w", err)
+		return err
 	}
+	return s.writeFile("token.enc", tokenData)
+}
 
-	decrypted, err := s.decrypt(encrypted)
+// marshalTokens returns the content of token.enc for tokens keyed by scopeKey
+func marshalTokens(tokens map[string]*oauth2.Token) ([]byte, error) {
+	f := tokenFile{Tokens: make(map[string]storedToken, len(tokens))}
+	for key, tok := range tokens {
+		f.Tokens[key] = storedToken{Token: *tok, Scope: tokenScope(tok)}
+	}
+	data, err := json.Marshal(f)
 	if err != nil {
-		return nil, fmt.Errorf("decrypt credentials: %w", err)
+		return nil, fmt.Errorf("marshal token: %w", err)
 	}
+	return data, nil
+}
 
-	return decrypted, nil
+// parseTokens parses the content of token.enc, in either format
+func parseTokens(data []byte) (map[string]*oauth2.Token, error) {
+	var f tokenFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("unmarshal token: %w", err)
+	}
+	if f.Tokens == nil {
+		var legacy storedToken
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return nil, fmt.Errorf("unmarshal token: %w", err)
+		}
+		tok := withScope(&legacy.Token, legacy.Scope)
+		return map[string]*oauth2.Token{scopeKey(tokenScopes(tok)): tok}, nil
+	}
+
+	tokens := make(map[string]*oauth2.Token, len(f.Tokens))
+	for key, st := range f.Tokens {
+		tokens[key] = withScope(&st.Token, st.Scope)
+	}
+	return tokens, nil
 }
 
-// StoreToken encrypts and stores OAuth token
-func (s *Store) StoreToken(token *oauth2.Token) error {
-	tokenData, err := json.Marshal(token)
+// LoadToken decrypts and loads the OAuth token stored for scopes (by default
+// all the app uses). An error wrapping os.ErrNotExist means there is none.
+func (s *Store) LoadToken(scopes ...string) (*oauth2.Token, error) {
+	l, err := s.lock(true)
 	if err != nil {
-		return fmt.Errorf("marshal token: %w", err)
+		return nil, err
 	}
+	defer l.Release()
+	return s.loadToken(scopes...)
+}
 
-	encrypted, err := s.encrypt(tokenData)
+func (s *Store) loadToken(scopes ...string) (*oauth2.Token, error) {
+	tokens, err := s.loadTokens()
 	if err != nil {
-		return fmt.Errorf("encrypt token: %w", err)
+		return nil, err
 	}
-
-	tokenPath := filepath.Join(s.baseDir, "token.enc")
-	if err := os.WriteFile(tokenPath, encrypted, 0600); err != nil {
-		return fmt.Errorf("write encrypted token: %w", err)
+	key := scopeKey(withDefaultScopes(scopes))
+	tok, ok := tokens[key]
+	if !ok {
+		return nil, fmt.Errorf("no token stored for the scope(s) %s: %w", key, os.ErrNotExist)
 	}
-	fmt.Println("Writing to", string(tokenPath))
-	return nil
+	return tok, nil
 }
 
-// LoadToken decrypts and loads OAuth token
-func (s *Store) LoadToken() (*oauth2.Token, error) {
+func (s *Store) loadTokens() (map[string]*oauth2.Token, error) {
 	tokenPath := filepath.Join(s.baseDir, "token.enc")
 	encrypted, err := os.ReadFile(tokenPath)
 	if err != nil {
 		return nil, fmt.Errorf("read encrypted token: %w", err)
 	}
 
-	decrypted, err := s.decrypt(encrypted)
+	decrypted, err := s.decrypt(encrypted, "token.enc")
 	if err != nil {
 		return nil, fmt.Errorf("decrypt token: %w", err)
 	}
-
-	var token oauth2.Token
-	if err := json.Unmarshal(decrypted, &token); err != nil {
-		return nil, fmt.Errorf("unmarshal token: %w", err)
-	}
-
-	return &token, nil
+	return parseTokens(decrypted)
 }
 
-// GetOAuthClient returns a configured OAuth client with secure credential handling
+// GetOAuthClient returns a configured OAuth client with secure credential
+// handling, for the given scopes (by default all the app uses). Each set of
+// scopes has a token of its own, so that no operation holds more access than
+// it needs. Without a token for the scopes, or when the user granted fewer
+// than asked, it runs the loopback authorization flow if a terminal is
+// attached; otherwise it fails, with a MissingScopesError for missing scopes.
+// Tokens refreshed by the client are written back to the store; a revoked
+// refresh token yields ErrReauthorize.
 func (s *Store) GetOAuthClient(ctx context.Context, scopes ...string) (*http.Client, error) {
-	// Default scopes if none provided
-	if len(scopes) == 0 {
-		scopes = []string{
-			gmail.GmailReadonlyScope,
-			gmail.GmailModifyScope,
-			gmail.GmailSendScope,
-		}
-	}
-
 	// Load encrypted credentials
 	credData, err := s.LoadCredentials()
 	if err != nil {
 		return nil, fmt.Errorf("load credentials: %w", err)
 	}
 
-	config, err := google.ConfigFromJSON(credData, scopes...)
+	config, err := google.ConfigFromJSON(credData, withDefaultScopes(scopes)...)
 	if err != nil {
 		return nil, fmt.Errorf("parse credentials: %w", err)
 	}
 
-	// Try to load existing token
-	tok, err := s.LoadToken()
-	if err != nil {
-		// Get new token if none exists
-		tok, err = s.getTokenFromWeb(ctx, config)
-		if err != nil {
+	// Try to load the token for these scopes
+	tok, err := s.LoadToken(config.Scopes...)
+	var missing []string
+	if err == nil {
+		missing = MissingScopes(tokenScopes(tok), config.Scopes)
+	}
+	if err != nil || len(missing) > 0 {
+		switch {
+		case interactive():
+		case err != nil:
+			return nil, fmt.Errorf("%w; run the command once from a terminal, or 'newsletterdigest_go setup', to authorize Gmail access", err)
+		default:
+			return nil, &MissingScopesError{Scopes: missing}
+		}
+		// Get a new token for exactly these scopes
+		if tok, err = authorize(ctx, config, AuthOptions{}); err != nil {
 			return nil, err
 		}
 		// Store the new token securely
-		if err := s.StoreToken(tok); err != nil {
+		if err := s.StoreToken(tok, config.Scopes...); err != nil {
 			return nil, fmt.Errorf("store new token: %w", err)
 		}
 	}
 
-	// Check if token needs refresh
-	if !tok.Valid() {
-		tokenSource := config.TokenSource(ctx, tok)
-		newToken, err := tokenSource.Token()
-		if err != nil {
-			return nil, fmt.Errorf("refresh token: %w", err)
-		}
-		// Store refreshed token
-		if err := s.StoreToken(newToken); err != nil {
-			return nil, fmt.Errorf("store refreshed token: %w", err)
-		}
-		tok = newToken
+	// Refresh now if needed, so that a revoked token fails before the run
+	// starts; later refreshes are stored as they happen
+	ts := newPersistingTokenSource(ctx, s, config, tok)
+	if _, err := ts.Token(); err != nil {
+		return nil, err
 	}
 
-	return config.Client(ctx, tok), nil
+	return oauth2.NewClient(ctx, ts), nil
 }
 
-// getTokenFromWeb handles the OAuth flow
-func (s *Store) getTokenFromWeb(ctx context.Context, config *oauth2.Config) (*oauth2.Token, error) {
-	// Generate secure state token
-	stateBytes := make([]byte, 32)
-	if _, err := rand.Read(stateBytes); err != nil {
-		return nil, fmt.Errorf("generate state token: %w", err)
+// withDefaultScopes returns scopes, or the Gmail scopes the app needs if none
+// are given
+func withDefaultScopes(scopes []string) []string {
+	if len(scopes) > 0 {
+		return scopes
 	}
-	stateToken := fmt.Sprintf("%x", stateBytes)
-
-	authURL := config.AuthCodeURL(stateToken, oauth2.AccessTypeOffline)
-
-	fmt.Println("Authorize this app, then paste the authorization code:")
-	fmt.Println(authURL)
-
-	var code string
-	fmt.Print("Enter authorization code: ")
-	if _, err := fmt.Scan(&code); err != nil {
-		return nil, fmt.Errorf("read authorization code: %w", err)
+	return []string{
+		gmail.GmailReadonlyScope,
+		gmail.GmailModifyScope,
+		gmail.GmailSendScope,
 	}
-
-	// Add timeout for token exchange
-	exchangeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	token, err := config.Exchange(exchangeCtx, code)
-	if err != nil {
-		return nil, fmt.Errorf("exchange authorization code: %w", err)
-	}
-
-	return token, nil
 }
 
 // SetupFromFile initializes the credential store from a Google credentials file
@@ -338,30 +379,38 @@ func (s *Store) SetupFromFile(credentialsPath string) error {
 	return nil
 }
 
-// ValidateEnvironment checks that all required environment variables are set
-func ValidateEnvironment() error {
-	required := map[string]string{
-		"ANTHROPIC_API_KEY":      "Anthropic API key for Claude summarization",
-		"TO_EMAIL":               "Destination email address",
-		"CREDENTIALS_PASSPHRASE": "Passphrase for credential encryption",
-	}
-
-	for env, desc := range required {
-		if os.Getenv(env) == "" {
-			return fmt.Errorf("required environment variable %s not set (%s)", env, desc)
+// ValidateSecrets checks the environment variables that can only be supplied
+// through the environment, never as command-line flags
+func ValidateSecrets() error {
+	required := []struct {
+		env, desc string
+		storable  bool // may be kept in the credential store
+	}{
+		{"ANTHROPIC_API_KEY", "Anthropic API key for Claude summarization", true},
+		{"CREDENTIALS_PASSPHRASE", "Passphrase for credential encryption", false},
+	}
+
+	for _, r := range required {
+		if config.Secret(r.env) == "" {
+			stored := ""
+			if r.storable {
+				stored = " and not in the credential store"
+			}
+			return fmt.Errorf("required environment variable %s (or %s_FILE or %s_COMMAND) not set%s (%s)", r.env, r.env, r.env, stored, r.desc)
 		}
 	}
 
-	// Validate email format
-	if _, err := mail.ParseAddress(os.Getenv("TO_EMAIL")); err != nil {
-		return fmt.Errorf("invalid TO_EMAIL format: %w", err)
-	}
-
 	return nil
 }
 
 // Cleanup removes all stored credentials (for testing or reset)
 func (s *Store) Cleanup() error {
+	l, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
 	credPath := filepath.Join(s.baseDir, "credentials.enc")
 	tokenPath := filepath.Join(s.baseDir, "token.enc")
 
@@ -372,6 +421,12 @@ func (s *Store) Cleanup() error {
 	if err := os.Remove(tokenPath); err != nil && !os.IsNotExist(err) {
 		errs = append(errs, fmt.Errorf("remove token: %w", err))
 	}
+	if err := os.Remove(filepath.Join(s.baseDir, secretsFile)); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("remove secrets: %w", err))
+	}
+	if err := os.Remove(filepath.Join(s.baseDir, serviceAccountFile)); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("remove service account key: %w", err))
+	}
 
 	if len(errs) > 0 {
 		return fmt.Errorf("cleanup errors: %v", errs)
@@ -0,0 +1,70 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrReauthorize is returned when Google rejects the stored refresh token,
+// because it was revoked, expired or issued for another client
+var ErrReauthorize = errors.New("the stored refresh token is no longer valid; re-run 'newsletterdigest_go setup' to authorize Gmail access again")
+
+// persistingTokenSource stores every new token its source returns, so that
+// tokens refreshed in the middle of a long run survive it
+type persistingTokenSource struct {
+	mu     sync.Mutex
+	store  *Store
+	scopes []string // the scopes the token is stored for
+	src    oauth2.TokenSource
+	last   *oauth2.Token
+}
+
+// newPersistingTokenSource returns a token source that refreshes tok through
+// config and writes each new token to the store as the token for the scopes
+// of config. Calls are serialized, so concurrent requests refresh and write
+// the token once.
+func newPersistingTokenSource(ctx context.Context, store *Store, config *oauth2.Config, tok *oauth2.Token) *persistingTokenSource {
+	return &persistingTokenSource{store: store, scopes: config.Scopes, src: config.TokenSource(ctx, tok), last: tok}
+}
+
+func (p *persistingTokenSource) Token() (*oauth2.Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tok, err := p.src.Token()
+	if err != nil {
+		if isInvalidGrant(err) {
+			return nil, fmt.Errorf("refresh token: %w", ErrReauthorize)
+		}
+		return nil, fmt.Errorf("refresh token: %w", err)
+	}
+	if p.last != nil && tok.AccessToken == p.last.AccessToken {
+		return tok, nil
+	}
+
+	// Google omits the refresh token from refresh responses; oauth2 carries
+	// the old one over, but keep it explicitly in case a source does not.
+	// The granted scopes are kept likewise.
+	if tok.RefreshToken == "" && p.last != nil {
+		tok.RefreshToken = p.last.RefreshToken
+	}
+	if tokenScope(tok) == "" && p.last != nil {
+		tok = withScope(tok, tokenScope(p.last))
+	}
+	if err := p.store.StoreToken(tok, p.scopes...); err != nil {
+		return nil, fmt.Errorf("store refreshed token: %w", err)
+	}
+	p.last = tok
+	return tok, nil
+}
+
+// isInvalidGrant reports whether the token endpoint rejected the refresh
+// token itself, rather than failing transiently
+func isInvalidGrant(err error) bool {
+	var re *oauth2.RetrieveError
+	return errors.As(err, &re) && re.ErrorCode == "invalid_grant"
+}
@@ -0,0 +1,72 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestPersistingTokenSource(t *testing.T) {
+	var refreshes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshes.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "fresh", "token_type": "Bearer", "expires_in": 3600})
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t, t.TempDir(), "pass")
+	expired := &oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)}
+	ts := newPersistingTokenSource(context.Background(), store, testOAuthConfig(srv.URL), expired)
+
+	// Concurrent callers share one refresh
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.Token(); err != nil {
+				t.Errorf("Token failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("token endpoint called %d times, want 1", n)
+	}
+
+	stored, err := store.LoadToken("scope")
+	if err != nil {
+		t.Fatalf("LoadToken failed: %v", err)
+	}
+	if stored.AccessToken != "fresh" || stored.RefreshToken != "refresh" {
+		t.Errorf("stored token = %+v, want the refreshed token with the old refresh token", stored)
+	}
+}
+
+func TestPersistingTokenSourceInvalidGrant(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`))
+	}))
+	defer srv.Close()
+
+	store := newTestStore(t, t.TempDir(), "pass")
+	expired := &oauth2.Token{AccessToken: "stale", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}
+	_, err := newPersistingTokenSource(context.Background(), store, testOAuthConfig(srv.URL), expired).Token()
+	if !errors.Is(err, ErrReauthorize) {
+		t.Errorf("Token error = %v, want ErrReauthorize", err)
+	}
+	if _, err := store.LoadToken(); err == nil {
+		t.Error("a token was stored although the refresh failed")
+	}
+}
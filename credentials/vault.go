@@ -0,0 +1,127 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrSecretNotFound is returned for a secret that is not in the store
+var ErrSecretNotFound = errors.New("secret not found")
+
+// secretNameRE matches the names of stored secrets, which are those of the
+// environment variables they stand in for
+var secretNameRE = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+const secretsFile = "secrets.enc"
+
+// SecretsSource names the store as the source of a secret
+const SecretsSource = "credential store"
+
+// Secrets returns every secret in the store by name. Without any stored
+// secret, the map is empty.
+func (s *Store) Secrets() (map[string]string, error) {
+	l, err := s.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Release()
+	return s.secrets()
+}
+
+func (s *Store) secrets() (map[string]string, error) {
+	encrypted, err := os.ReadFile(filepath.Join(s.baseDir, secretsFile))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read encrypted secrets: %w", err)
+	}
+
+	decrypted, err := s.decrypt(encrypted, secretsFile)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt secrets: %w", err)
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(decrypted, &secrets); err != nil {
+		return nil, fmt.Errorf("unmarshal secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// GetSecret returns a stored secret
+func (s *Store) GetSecret(name string) (string, error) {
+	secrets, err := s.Secrets()
+	if err != nil {
+		return "", err
+	}
+	v, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, ErrSecretNotFound)
+	}
+	return v, nil
+}
+
+// SetSecret adds or replaces a stored secret
+func (s *Store) SetSecret(name, value string) error {
+	if !secretNameRE.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q (use upper-case letters, digits and _)", name)
+	}
+	if strings.HasPrefix(name, "CREDENTIALS_") {
+		return fmt.Errorf("%s configures the store and cannot be kept in it", name)
+	}
+	if value == "" {
+		return fmt.Errorf("%s: empty value", name)
+	}
+
+	l, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	secrets, err := s.secrets()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return s.writeSecrets(secrets)
+}
+
+// DeleteSecret removes a stored secret
+func (s *Store) DeleteSecret(name string) error {
+	l, err := s.lock(false)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	secrets, err := s.secrets()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("%s: %w", name, ErrSecretNotFound)
+	}
+	delete(secrets, name)
+	if len(secrets) == 0 {
+		if err := os.Remove(filepath.Join(s.baseDir, secretsFile)); err != nil {
+			return fmt.Errorf("remove secrets: %w", err)
+		}
+		return nil
+	}
+	return s.writeSecrets(secrets)
+}
+
+// writeSecrets encrypts the secrets and replaces secrets.enc
+func (s *Store) writeSecrets(secrets map[string]string) error {
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("marshal secrets: %w", err)
+	}
+	return s.writeFile(secretsFile, data)
+}
@@ -0,0 +1,70 @@
+package credentials
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestVault(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStore(t, dir, "pass")
+
+	if secrets, err := store.Secrets(); err != nil || len(secrets) != 0 {
+		t.Fatalf("Secrets of an empty store = %v, %v", secrets, err)
+	}
+	for name, value := range map[string]string{"ANTHROPIC_API_KEY": "sk-1", "FORUMSCOUT_API_KEY": "fs-1"} {
+		if err := store.SetSecret(name, value); err != nil {
+			t.Fatalf("SetSecret(%s) failed: %v", name, err)
+		}
+	}
+	if err := store.SetSecret("ANTHROPIC_API_KEY", "sk-2"); err != nil {
+		t.Fatalf("SetSecret replace failed: %v", err)
+	}
+
+	// Secrets are readable by another store with the same passphrase only
+	if got, err := newTestStore(t, dir, "pass").GetSecret("ANTHROPIC_API_KEY"); err != nil || got != "sk-2" {
+		t.Errorf("GetSecret = %q, %v, want sk-2", got, err)
+	}
+	if _, err := newTestStore(t, dir, "wrong").Secrets(); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Secrets with a wrong passphrase = %v, want ErrDecrypt", err)
+	}
+
+	secrets, err := store.Secrets()
+	if err != nil || !slices.Equal(slices.Sorted(maps.Keys(secrets)), []string{"ANTHROPIC_API_KEY", "FORUMSCOUT_API_KEY"}) {
+		t.Errorf("Secrets = %v, %v", slices.Sorted(maps.Keys(secrets)), err)
+	}
+
+	if err := store.DeleteSecret("FORUMSCOUT_API_KEY"); err != nil {
+		t.Fatalf("DeleteSecret failed: %v", err)
+	}
+	if _, err := store.GetSecret("FORUMSCOUT_API_KEY"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("GetSecret after delete = %v, want ErrSecretNotFound", err)
+	}
+	if err := store.DeleteSecret("FORUMSCOUT_API_KEY"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("DeleteSecret of a missing secret = %v, want ErrSecretNotFound", err)
+	}
+
+	if err := newTestStore(t, t.TempDir(), "pass").Rotate("new-pass"); err == nil {
+		t.Error("Rotate of an empty store succeeded")
+	}
+	if err := store.Rotate("new-pass"); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if got, err := newTestStore(t, dir, "new-pass").GetSecret("ANTHROPIC_API_KEY"); err != nil || got != "sk-2" {
+		t.Errorf("GetSecret after rotation = %q, %v", got, err)
+	}
+}
+
+func TestSetSecretRejectsInvalidNames(t *testing.T) {
+	store := newTestStore(t, t.TempDir(), "pass")
+	for _, name := range []string{"", "lower", "1ABC", "A-B", "CREDENTIALS_PASSPHRASE"} {
+		if err := store.SetSecret(name, "v"); err == nil {
+			t.Errorf("SetSecret(%q) succeeded", name)
+		}
+	}
+	if err := store.SetSecret("EMPTY", ""); err == nil {
+		t.Error("SetSecret with an empty value succeeded")
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"newsletterdigest_go/config"
+	"newsletterdigest_go/credentials"
+	"newsletterdigest_go/gmail"
+	"newsletterdigest_go/openai"
+)
+
+// Doctor check outcomes
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// checkResult is one row of the doctor report
+type checkResult struct {
+	name   string
+	status string
+	detail string
+	hint   string
+}
+
+// probes are the network calls behind the checks, replaced in tests
+type probes struct {
+	inspectToken func(ctx context.Context, store *credentials.Store, scopes []string) (*credentials.TokenStatus, error)
+	gmailQuery   func(ctx context.Context, client *http.Client, query string) (int64, error)
+	model        func(ctx context.Context, model string) error
+}
+
+func defaultProbes(logger *slog.Logger) probes {
+	client := openai.NewClient(logger)
+	return probes{
+		inspectToken: func(ctx context.Context, store *credentials.Store, scopes []string) (*credentials.TokenStatus, error) {
+			return store.InspectToken(ctx, scopes...)
+		},
+		gmailQuery: func(ctx context.Context, httpClient *http.Client, query string) (int64, error) {
+			svc, err := gmail.NewServiceFromClient(ctx, logger, httpClient)
+			if err != nil {
+				return 0, err
+			}
+			return svc.CheckQuery(ctx, query)
+		},
+		model: client.CheckModel,
+	}
+}
+
+// doctor runs each check independently and collects the results
+type doctor struct {
+	cfg     *config.Config
+	logger  *slog.Logger
+	probes  probes
+	out     io.Writer
+	results []checkResult
+}
+
+func (d *doctor) add(name, status, detail, hint string) bool {
+	d.results = append(d.results, checkResult{name, status, detail, hint})
+	return status == checkPass || status == checkWarn
+}
+
+func doctorCommand(args []string) error {
+	fs := newFlagSet("doctor", "Check configuration, stored credentials and connectivity one piece at a time.")
+	timeout := fs.Duration("timeout", 20*time.Second, "timeout for each network check")
+	cfg, logger, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := setupContext()
+	defer cancel()
+
+	d := &doctor{cfg: cfg, logger: logger, probes: defaultProbes(logger), out: os.Stdout}
+	d.checkEnvironment(ctx)
+	client := d.checkCredentials(ctx, *timeout)
+	d.checkGmail(ctx, *timeout, client)
+	d.checkAnthropic(ctx, *timeout)
+
+	return d.print()
+}
+
+func (d *doctor) checkEnvironment(ctx context.Context) {
+	if err := config.ResolveSecrets(ctx); err != nil {
+		d.add("secrets", checkFail, strings.ReplaceAll(err.Error(), "\n", "; "), "fix the _FILE or _COMMAND variables named above")
+	}
+	if err := loadStoredSecrets(); err != nil {
+		d.add("stored secrets", checkFail, err.Error(), "check CREDENTIALS_PASSPHRASE, or list the secrets with 'newsletterdigest_go secrets list'")
+	}
+
+	for _, env := range []string{"ANTHROPIC_API_KEY", "CREDENTIALS_PASSPHRASE"} {
+		if config.Secret(env) == "" {
+			d.add("env "+env, checkFail, "not set", "export "+env+", "+env+"_FILE or "+env+"_COMMAND, or add it to .env")
+		} else {
+			d.add("env "+env, checkPass, "set from "+config.SecretSource(env), "")
+		}
+	}
+
+	if err := d.cfg.Validate(); err != nil {
+		d.add("configuration", checkFail, strings.ReplaceAll(err.Error(), "\n", "; "),
+			"set TO_EMAIL (or --to-email, or PROFILE_<NAME>_TO_EMAIL) to a valid address")
+	} else if len(d.cfg.Profiles) > 0 {
+		d.add("configuration", checkPass, fmt.Sprintf("%d profiles", len(d.cfg.Profiles)), "")
+	} else {
+		d.add("configuration", checkPass, "recipient "+d.cfg.ToEmail, "")
+	}
+
+	switch {
+	case !d.cfg.FetchLinkedInHashtags:
+		d.add("env FORUMSCOUT_API_KEY", checkSkip, "LinkedIn fetching disabled", "")
+	case config.Secret("FORUMSCOUT_API_KEY") == "":
+		d.add("env FORUMSCOUT_API_KEY", checkWarn, "not set, LinkedIn posts will be mock data",
+			"export FORUMSCOUT_API_KEY or disable FETCH_LINKEDIN_HASHTAGS")
+	default:
+		d.add("env FORUMSCOUT_API_KEY", checkPass, "set", "")
+	}
+}
+
+// checkCredentials returns a client authorized by the stored credentials, or
+// nil when they are unusable. Like the checks, the client leaves the store
+// untouched and never starts an authorization.
+func (d *doctor) checkCredentials(ctx context.Context, timeout time.Duration) *http.Client {
+	store, err := credentials.NewStoreFromEnv()
+	if err != nil {
+		d.add("credential store", checkFail, err.Error(), "set CREDENTIALS_PASSPHRASE and check CREDENTIALS_DIR is writable")
+		d.add("credentials.enc", checkSkip, "no credential store", "")
+		d.add("token.enc", checkSkip, "no credential store", "")
+		return nil
+	}
+	d.add("credential store", checkPass, "opened", "")
+
+	if d.cfg.GmailAuth == config.GmailAuthServiceAccount {
+		return d.checkServiceAccount(ctx, store, timeout)
+	}
+
+	_, err = store.LoadCredentials()
+	credsOK := d.add("credentials.enc", decryptStatus(err), errDetail(err, "decrypted"),
+		decryptHint(err, "run 'newsletterdigest_go setup --credentials-file credentials.json'"))
+
+	// The token of the scopes a run needs with this configuration
+	scopes := runAccess(d.cfg).Scopes()
+	_, err = store.LoadToken(scopes...)
+	tokenOK := d.add("token.enc", decryptStatus(err), errDetail(err, "decrypted"),
+		decryptHint(err, "run 'newsletterdigest_go run' once from a terminal, or 'newsletterdigest_go setup', to authorize Gmail access"))
+
+	if !credsOK || !tokenOK {
+		d.add("token validity", checkSkip, "credentials or token unavailable", "")
+		d.add("token scopes", checkSkip, "credentials or token unavailable", "")
+		return nil
+	}
+
+	inspectCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	status, err := d.probes.inspectToken(inspectCtx, store, scopes)
+	if status == nil {
+		hint := "check network access to oauth2.googleapis.com"
+		if errors.Is(err, credentials.ErrReauthorize) {
+			hint = "run 'newsletterdigest_go setup' to authorize Gmail access again"
+		}
+		d.add("token validity", checkFail, errDetail(err, ""), hint)
+		d.add("token scopes", checkSkip, "token unusable", "")
+		return nil
+	}
+
+	detail := "expires " + status.Expiry.Local().Format(time.RFC3339)
+	if status.Refreshed {
+		detail = "access token expired, refresh works; new token " + detail
+	}
+	if !status.HasRefresh {
+		d.add("token validity", checkWarn, detail+", no refresh token stored",
+			"re-authorize to obtain a refresh token, otherwise runs fail once the access token expires")
+	} else {
+		d.add("token validity", checkPass, detail, "")
+	}
+
+	if err != nil {
+		d.add("token scopes", checkFail, err.Error(), "check network access to oauth2.googleapis.com")
+		return status.Client(ctx)
+	}
+
+	missing := credentials.MissingScopes(status.Scopes, scopes)
+	if len(missing) > 0 {
+		d.add("token scopes", checkFail, "missing "+strings.Join(missing, ", "),
+			"run 'newsletterdigest_go run' once from a terminal, or re-run setup, to grant the missing scopes")
+	} else {
+		d.add("token scopes", checkPass, strings.Join(status.Scopes, " "), "")
+	}
+	return status.Client(ctx)
+}
+
+func (d *doctor) checkGmail(ctx context.Context, timeout time.Duration, client *http.Client) {
+	if client == nil {
+		d.add("gmail query", checkSkip, "no usable token", "")
+		return
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, pc := range d.cfg.ProfileConfigs() {
+		name := "gmail query"
+		if len(d.cfg.Profiles) > 0 {
+			name += " " + pc.Profile
+		}
+
+		count, err := d.probes.gmailQuery(checkCtx, client, pc.GmailQuery)
+		if err != nil {
+			d.add(name, checkFail, err.Error(), "fix GMAIL_QUERY (or --gmail-query, or PROFILE_<NAME>_GMAIL_QUERY)")
+			continue
+		}
+		d.add(name, checkPass, fmt.Sprintf("%q matches ~%d messages", pc.GmailQuery, count), "")
+	}
+}
+
+func (d *doctor) checkAnthropic(ctx context.Context, timeout time.Duration) {
+	if config.Secret("ANTHROPIC_API_KEY") == "" {
+		d.add("anthropic models", checkSkip, "ANTHROPIC_API_KEY not set", "")
+		return
+	}
+
+	for _, model := range []string{d.cfg.SmallModel, d.cfg.FinalModel} {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := d.probes.model(checkCtx, model)
+		cancel()
+
+		if err != nil {
+			d.add("anthropic "+model, checkFail, err.Error(),
+				"check ANTHROPIC_API_KEY and the CLAUDE_MODEL_SMALL/CLAUDE_MODEL_FINAL names")
+		} else {
+			d.add("anthropic "+model, checkPass, "reachable", "")
+		}
+	}
+}
+
+// print writes the result table followed by remediation hints and returns an
+// error if any check failed
+func (d *doctor) print() error {
+	tw := tabwriter.NewWriter(d.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECK\tDETAIL")
+	for _, r := range d.results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.status, r.name, r.detail)
+	}
+	tw.Flush()
+
+	failed := false
+	var hints []string
+	for _, r := range d.results {
+		if r.status == checkFail {
+			failed = true
+		}
+		if r.hint != "" && (r.status == checkFail || r.status == checkWarn) {
+			hints = append(hints, fmt.Sprintf("  %s: %s", r.name, r.hint))
+		}
+	}
+	if len(hints) > 0 {
+		fmt.Fprintln(d.out, "\nHints:")
+		fmt.Fprintln(d.out, strings.Join(hints, "\n"))
+	}
+
+	if failed {
+		return errors.New("doctor found problems")
+	}
+	return nil
+}
+
+// checkServiceAccount returns a client of the stored service account acting
+// for the configured mailbox, or nil when it cannot
+func (d *doctor) checkServiceAccount(ctx context.Context, store *credentials.Store, timeout time.Duration) *http.Client {
+	_, err := store.LoadServiceAccount()
+	if !d.add("service_account.enc", decryptStatus(err), errDetail(err, "decrypted"),
+		decryptHint(err, "run 'newsletterdigest_go setup --service-account-file key.json'")) {
+		d.add("delegation", checkSkip, "service account key unavailable", "")
+		return nil
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := store.ServiceAccountClient(checkCtx, d.cfg.GmailSubject, runAccess(d.cfg).Scopes()...)
+	if err != nil {
+		d.add("delegation", checkFail, err.Error(),
+			"allow the service account domain-wide delegation for the Gmail scopes in the Workspace admin console")
+		return nil
+	}
+	d.add("delegation", checkPass, "impersonates "+d.cfg.GmailSubject, "")
+	return client
+}
+
+func decryptStatus(err error) string {
+	if err != nil {
+		return checkFail
+	}
+	return checkPass
+}
+
+func decryptHint(err error, missingHint string) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, os.ErrNotExist):
+		return missingHint
+	case errors.Is(err, credentials.ErrDecrypt):
+		return "CREDENTIALS_PASSPHRASE differs from the one used when the file was written"
+	default:
+		return "check the permissions of CREDENTIALS_DIR"
+	}
+}
+
+func errDetail(err error, ok string) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ok
+}
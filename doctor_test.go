@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"newsletterdigest_go/config"
+	"newsletterdigest_go/credentials"
+	"newsletterdigest_go/gmail"
+	"newsletterdigest_go/logging"
+)
+
+func testDoctor(cfg *config.Config, p probes) (*doctor, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &doctor{cfg: cfg, logger: logging.Discard(), probes: p, out: out}, out
+}
+
+// result returns the result of the named check
+func (d *doctor) result(t *testing.T, name string) checkResult {
+	t.Helper()
+	for _, r := range d.results {
+		if r.name == name {
+			return r
+		}
+	}
+	t.Fatalf("No %q check in %+v", name, d.results)
+	return checkResult{}
+}
+
+func TestDoctorCredentials(t *testing.T) {
+	readOnly := gmail.Access{}.Scopes()
+	full := gmail.FullAccess.Scopes()
+
+	tests := []struct {
+		name       string
+		noToken    bool
+		status     *credentials.TokenStatus
+		err        error
+		want       map[string]string // check name to status
+		wantHint   string
+		wantClient bool
+	}{
+		{
+			name:       "usable token",
+			status:     &credentials.TokenStatus{HasRefresh: true, Scopes: full},
+			want:       map[string]string{"credentials.enc": checkPass, "token.enc": checkPass, "token validity": checkPass, "token scopes": checkPass},
+			wantClient: true,
+		},
+		{
+			name:       "missing scopes",
+			status:     &credentials.TokenStatus{HasRefresh: true, Scopes: readOnly},
+			want:       map[string]string{"token validity": checkPass, "token scopes": checkFail},
+			wantHint:   "grant the missing scopes",
+			wantClient: true,
+		},
+		{
+			name:       "no refresh token",
+			status:     &credentials.TokenStatus{Scopes: full},
+			want:       map[string]string{"token validity": checkWarn, "token scopes": checkPass},
+			wantHint:   "obtain a refresh token",
+			wantClient: true,
+		},
+		{
+			name:     "revoked token",
+			err:      fmt.Errorf("refresh token: %w", credentials.ErrReauthorize),
+			want:     map[string]string{"token validity": checkFail, "token scopes": checkSkip},
+			wantHint: "authorize Gmail access again",
+		},
+		{
+			name:     "no token",
+			noToken:  true,
+			want:     map[string]string{"credentials.enc": checkPass, "token.enc": checkFail, "token validity": checkSkip},
+			wantHint: "run 'newsletterdigest_go run' once from a terminal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("CREDENTIALS_DIR", dir)
+			t.Setenv("CREDENTIALS_PASSPHRASE", "test passphrase")
+			store, err := credentials.NewStoreFromEnv()
+			if err != nil {
+				t.Fatalf("NewStoreFromEnv failed: %v", err)
+			}
+			if err := store.StoreCredentials([]byte(`{"installed":{"client_id":"id"}}`)); err != nil {
+				t.Fatalf("StoreCredentials failed: %v", err)
+			}
+			if !tt.noToken {
+				if err := store.StoreToken(&oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}); err != nil {
+					t.Fatalf("StoreToken failed: %v", err)
+				}
+			}
+
+			d, _ := testDoctor(config.Default(), probes{
+				inspectToken: func(context.Context, *credentials.Store, []string) (*credentials.TokenStatus, error) {
+					return tt.status, tt.err
+				},
+			})
+			client := d.checkCredentials(context.Background(), time.Second)
+
+			if got := client != nil; got != tt.wantClient {
+				t.Errorf("Client returned = %v, want %v", got, tt.wantClient)
+			}
+			for name, want := range tt.want {
+				if r := d.result(t, name); r.status != want {
+					t.Errorf("%s = %s (%s), want %s", name, r.status, r.detail, want)
+				}
+			}
+			if tt.wantHint != "" && !hasHint(d.results, tt.wantHint) {
+				t.Errorf("Expected a hint containing %q in %+v", tt.wantHint, d.results)
+			}
+		})
+	}
+}
+
+func hasHint(results []checkResult, hint string) bool {
+	for _, r := range results {
+		if strings.Contains(r.hint, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDoctorGmail(t *testing.T) {
+	cfg := config.Default()
+	d, _ := testDoctor(cfg, probes{
+		gmailQuery: func(ctx context.Context, client *http.Client, query string) (int64, error) {
+			return 42, nil
+		},
+	})
+	d.checkGmail(context.Background(), time.Second, http.DefaultClient)
+	r := d.result(t, "gmail query")
+	if want := fmt.Sprintf("%q matches ~42 messages", cfg.GmailQuery); r.status != checkPass || r.detail != want {
+		t.Errorf("gmail query = %s %q, want %s %q", r.status, r.detail, checkPass, want)
+	}
+
+	d, _ = testDoctor(cfg, probes{
+		gmailQuery: func(ctx context.Context, client *http.Client, query string) (int64, error) {
+			return 0, errors.New("invalid query")
+		},
+	})
+	d.checkGmail(context.Background(), time.Second, http.DefaultClient)
+	if r := d.result(t, "gmail query"); r.status != checkFail || r.detail != "invalid query" || !strings.Contains(r.hint, "fix GMAIL_QUERY") {
+		t.Errorf("Unexpected failed query result %+v", r)
+	}
+
+	// Without a usable token the query is never run
+	d, _ = testDoctor(cfg, probes{})
+	d.checkGmail(context.Background(), time.Second, nil)
+	if r := d.result(t, "gmail query"); r.status != checkSkip {
+		t.Errorf("gmail query = %s, want %s", r.status, checkSkip)
+	}
+}
+
+func TestDoctorAnthropic(t *testing.T) {
+	cfg := config.Default()
+	cfg.SmallModel = "small-model"
+	cfg.FinalModel = "final-model"
+	modelProbe := func(ctx context.Context, model string) error {
+		if model == "final-model" {
+			return errors.New("model not found")
+		}
+		return nil
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	d, _ := testDoctor(cfg, probes{model: modelProbe})
+	d.checkAnthropic(context.Background(), time.Second)
+	if r := d.result(t, "anthropic models"); r.status != checkSkip {
+		t.Errorf("anthropic models = %s without a key, want %s", r.status, checkSkip)
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "key")
+	d, _ = testDoctor(cfg, probes{model: modelProbe})
+	d.checkAnthropic(context.Background(), time.Second)
+	if r := d.result(t, "anthropic small-model"); r.status != checkPass {
+		t.Errorf("anthropic small-model = %s, want %s", r.status, checkPass)
+	}
+	if r := d.result(t, "anthropic final-model"); r.status != checkFail || !strings.Contains(r.hint, "CLAUDE_MODEL_FINAL") {
+		t.Errorf("Unexpected result for the missing model %+v", r)
+	}
+}
+
+func TestDoctorPrint(t *testing.T) {
+	d, out := testDoctor(config.Default(), probes{})
+	d.add("passing", checkPass, "fine", "never shown")
+	d.add("warning", checkWarn, "odd", "look into it")
+	if err := d.print(); err != nil {
+		t.Errorf("print failed without failed checks: %v", err)
+	}
+	for _, want := range []string{"STATUS  CHECK    DETAIL\n", "PASS    passing  fine\n", "WARN    warning  odd\n", "Hints:\n  warning: look into it\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out.String(), "never shown") {
+		t.Errorf("Hint of a passing check printed:\n%s", out)
+	}
+
+	d, out = testDoctor(config.Default(), probes{})
+	d.add("broken", checkFail, "bad", "fix it")
+	d.add("skipped", checkSkip, "not checked", "")
+	if err := d.print(); err == nil {
+		t.Error("Expected an error when a check failed")
+	}
+	if !strings.Contains(out.String(), "  broken: fix it\n") {
+		t.Errorf("Expected the hint of the failed check in:\n%s", out)
+	}
+}
@@ -1,9 +1,11 @@
 package fetcher
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -13,11 +15,22 @@ import (
 	"time"
 
 	html2text "github.com/jaytaylor/html2text"
+
+	"newsletterdigest_go/config"
 )
 
 type ContentFetcher struct {
-	client   *http.Client
-	cacheDir string
+	client        *http.Client
+	cacheDir      string
+	noCacheWrites bool
+	limits        Limits
+	logger        *slog.Logger
+}
+
+// Limits bound the content the fetcher returns
+type Limits struct {
+	MaxAge          time.Duration // oldest LinkedIn post returned
+	ArticleMaxChars int           // longest article text returned
 }
 
 type LinkedInPost struct {
@@ -29,19 +42,30 @@ type LinkedInPost struct {
 	Score     int // Quality score for ranking
 }
 
-func New() *ContentFetcher {
+func New(logger *slog.Logger, limits Limits) *ContentFetcher {
+	logger = logger.With("component", "fetcher")
+
 	// Create cache directory
 	cacheDir := filepath.Join(os.TempDir(), "forumscout_cache")
-	os.MkdirAll(cacheDir, 0755)
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		logger.Warn("create cache dir failed", "dir", cacheDir, "error", err)
+	}
 
 	return &ContentFetcher{
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 		cacheDir: cacheDir,
+		limits:   limits,
+		logger:   logger,
 	}
 }
 
+// DisableCacheWrites keeps reading cached API responses but stops writing new ones
+func (f *ContentFetcher) DisableCacheWrites() {
+	f.noCacheWrites = true
+}
+
 var linkedinURLPattern = regexp.MustCompile(`https://(?:www\.)?linkedin\.com/pulse/[^/\s]+/?`)
 
 func (f *ContentFetcher) ShouldFetchContent(text string, links []string) (bool, string) {
@@ -87,11 +111,11 @@ func (f *ContentFetcher) isLinkedInNewsletter(text string, links []string) bool
 	return false
 }
 
-func (f *ContentFetcher) FetchLinkedInContent(rawURL string) (string, error) {
+func (f *ContentFetcher) FetchLinkedInContent(ctx context.Context, rawURL string) (string, error) {
 	// Clean the LinkedIn URL - remove everything after the first '?'
 	cleanURL := f.cleanLinkedInURL(rawURL)
 
-	req, err := http.NewRequest("GET", cleanURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", cleanURL, nil)
 	if err != nil {
 		return "", err
 	}
@@ -124,6 +148,7 @@ func (f *ContentFetcher) FetchLinkedInContent(rawURL string) (string, error) {
 	text, err := html2text.FromString(bodyStr)
 	if err != nil {
 		// Fallback: basic HTML tag removal
+		f.logger.DebugContext(ctx, "html2text failed, stripping tags", "url", cleanURL, "error", err)
 		text = f.basicHTMLStrip(bodyStr)
 	}
 
@@ -190,8 +215,8 @@ func (f *ContentFetcher) cleanLinkedInURL(rawURL string) string {
 }
 
 // FetchLinkedInHashtagContent fetches recent posts from LinkedIn based on hashtags
-func (f *ContentFetcher) FetchLinkedInHashtagContent(hashtags []string, maxPosts int, fetchFullContent bool) ([]LinkedInPost, error) {
-	fmt.Printf("Fetching LinkedIn posts for hashtags: %v\n", hashtags)
+func (f *ContentFetcher) FetchLinkedInHashtagContent(ctx context.Context, hashtags []string, maxPosts int, fetchFullContent bool) ([]LinkedInPost, error) {
+	f.logger.InfoContext(ctx, "fetching LinkedIn posts", "hashtags", hashtags)
 
 	var allPosts []LinkedInPost
 
@@ -199,8 +224,9 @@ func (f *ContentFetcher) FetchLinkedInHashtagContent(hashtags []string, maxPosts
 		// Clean hashtag (remove # if present)
 		cleanTag := strings.TrimPrefix(hashtag, "#")
 
-		posts, err := f.fetchHashtagPosts(cleanTag, maxPosts/len(hashtags), fetchFullContent)
+		posts, err := f.fetchHashtagPosts(ctx, cleanTag, max(1, maxPosts/len(hashtags)), fetchFullContent)
 		if err != nil {
+			f.logger.WarnContext(ctx, "fetch hashtag posts failed", "hashtag", cleanTag, "error", err)
 			continue
 		}
 
@@ -215,14 +241,16 @@ func (f *ContentFetcher) FetchLinkedInHashtagContent(hashtags []string, maxPosts
 	return allPosts, nil
 }
 
-func (f *ContentFetcher) fetchHashtagPosts(hashtag string, limit int, fetchFullContent bool) ([]LinkedInPost, error) {
+func (f *ContentFetcher) fetchHashtagPosts(ctx context.Context, hashtag string, limit int, fetchFullContent bool) ([]LinkedInPost, error) {
 	// Check cache first
 	if cached, found := f.getCachedResponse(hashtag); found {
-		return f.processPosts(cached, hashtag, limit, fetchFullContent), nil
+		f.logger.DebugContext(ctx, "using cached posts", "hashtag", hashtag, "posts", len(cached))
+		return f.processPosts(ctx, cached, hashtag, limit, fetchFullContent), nil
 	}
 
-	forumScoutKey := os.Getenv("FORUMSCOUT_API_KEY")
+	forumScoutKey := config.Secret("FORUMSCOUT_API_KEY")
 	if forumScoutKey == "" {
+		f.logger.WarnContext(ctx, "FORUMSCOUT_API_KEY not set, using mock posts", "hashtag", hashtag)
 		return f.createMockPosts(hashtag, limit), nil
 	}
 
@@ -233,7 +261,7 @@ func (f *ContentFetcher) fetchHashtagPosts(hashtag string, limit int, fetchFullC
 
 	apiURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -276,20 +304,20 @@ func (f *ContentFetcher) fetchHashtagPosts(hashtag string, limit int, fetchFullC
 	}
 
 	// Cache the response
-	f.cacheResponse(hashtag, posts)
+	f.cacheResponse(ctx, hashtag, posts)
 
 	// Add rate limiting
 	time.Sleep(1 * time.Second)
 
-	return f.processPosts(posts, hashtag, limit, fetchFullContent), nil
+	return f.processPosts(ctx, posts, hashtag, limit, fetchFullContent), nil
 }
 
 // processPosts converts ForumScout posts to LinkedInPost format with scoring and filtering
-func (f *ContentFetcher) processPosts(posts []ForumScoutPost, hashtag string, limit int, fetchFullContent bool) []LinkedInPost {
+func (f *ContentFetcher) processPosts(ctx context.Context, posts []ForumScoutPost, hashtag string, limit int, fetchFullContent bool) []LinkedInPost {
 	var linkedInPosts []LinkedInPost
 
 	for _, post := range posts {
-		// Filter by post age (only last 7 days)
+		// Filter by post age
 		if !f.isRecentPost(post.Date) {
 			continue
 		}
@@ -310,12 +338,12 @@ func (f *ContentFetcher) processPosts(posts []ForumScoutPost, hashtag string, li
 			Score:     f.scorePost(post),
 		}
 
-		// Debug: Log the snippet content
-		// Process post snippet
-
 		// If full content fetching is enabled, get complete post content from LinkedIn URL
 		if fetchFullContent && len(snippet) < 300 {
-			if fullContent, err := f.FetchLinkedInContent(cleanURL); err == nil && len(fullContent) > len(snippet) {
+			fullContent, err := f.FetchLinkedInContent(ctx, cleanURL)
+			if err != nil {
+				f.logger.WarnContext(ctx, "fetch full post failed, using snippet", "url", cleanURL, "error", err)
+			} else if len(fullContent) > len(snippet) {
 				// Ensure full content is also clean text
 				cleanFullContent := f.cleanTextContent(fullContent)
 				linkedInPost.Text = cleanFullContent
@@ -372,7 +400,7 @@ func (f *ContentFetcher) cleanTextContent(text string) string {
 	return text
 }
 
-// isRecentPost filters posts to only include those from the last 7 days
+// isRecentPost filters posts to only include those within the maximum age
 func (f *ContentFetcher) isRecentPost(dateStr string) bool {
 	postDate, err := time.Parse("2006-01-02 15:04:05", dateStr)
 	if err != nil {
@@ -381,7 +409,7 @@ func (f *ContentFetcher) isRecentPost(dateStr string) bool {
 			return true // Include if we can't parse date
 		}
 	}
-	return time.Since(postDate) <= 7*24*time.Hour
+	return time.Since(postDate) <= f.limits.MaxAge
 }
 
 // scorePost assigns a quality score to posts for ranking
@@ -454,11 +482,19 @@ func (f *ContentFetcher) getCachedResponse(hashtag string) ([]ForumScoutPost, bo
 }
 
 // cacheResponse saves API response to cache
-func (f *ContentFetcher) cacheResponse(hashtag string, posts []ForumScoutPost) {
+func (f *ContentFetcher) cacheResponse(ctx context.Context, hashtag string, posts []ForumScoutPost) {
+	if f.noCacheWrites {
+		return
+	}
+
 	cacheFile := filepath.Join(f.cacheDir, fmt.Sprintf("forumscout_%s.json", hashtag))
 
-	if data, err := json.Marshal(posts); err == nil {
-		os.WriteFile(cacheFile, data, 0644)
+	data, err := json.Marshal(posts)
+	if err == nil {
+		err = os.WriteFile(cacheFile, data, 0644)
+	}
+	if err != nil {
+		f.logger.WarnContext(ctx, "cache write failed", "hashtag", hashtag, "file", cacheFile, "error", err)
 	}
 }
 
@@ -553,16 +589,9 @@ func (f *ContentFetcher) extractLinkedInArticleContent(text string) string {
 	content = strings.TrimSpace(content)
 
 	// Limit content length to avoid overwhelming the summarizer
-	if len(content) > 8000 {
-		content = content[:8000] + "... [content truncated]"
+	if len(content) > f.limits.ArticleMaxChars {
+		content = content[:f.limits.ArticleMaxChars] + "... [content truncated]"
 	}
 
 	return content
 }
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
@@ -3,6 +3,8 @@ package gmail
 import (
 	"context"
 	"encoding/base64"
+	"log/slog"
+	"net/http"
 	"net/mail"
 	"strings"
 
@@ -15,78 +17,159 @@ import (
 )
 
 type Service struct {
-	svc *gmail.Service
+	svc    *gmail.Service
+	logger *slog.Logger
 }
 
-func NewService(ctx context.Context) (*Service, error) {
+// Access selects what a Service may do besides reading messages. Only the
+// OAuth scopes it needs are requested.
+type Access struct {
+	Modify bool // mark messages as read
+	Send   bool // send the digest
+}
+
+// FullAccess is what a run that sends the digest needs
+var FullAccess = Access{Modify: true, Send: true}
+
+// Scopes returns the OAuth scopes access needs
+func (a Access) Scopes() []string {
+	scopes := []string{gmail.GmailReadonlyScope}
+	if a.Modify {
+		scopes = append(scopes, gmail.GmailModifyScope)
+	}
+	if a.Send {
+		scopes = append(scopes, gmail.GmailSendScope)
+	}
+	return scopes
+}
+
+// Auth selects how a Service authenticates
+type Auth struct {
+	// Subject, when set, is the mailbox the stored service account
+	// impersonates; otherwise the stored OAuth token is used
+	Subject string
+}
+
+// NewService connects to the mailbox with the scopes access needs
+func NewService(ctx context.Context, logger *slog.Logger, auth Auth, access Access) (*Service, error) {
 	store, err := credentials.NewStoreFromEnv()
 	if err != nil {
 		return nil, err
 	}
 
-	client, err := store.GetOAuthClient(ctx)
+	var client *http.Client
+	if auth.Subject != "" {
+		client, err = store.ServiceAccountClient(ctx, auth.Subject, access.Scopes()...)
+	} else {
+		client, err = store.GetOAuthClient(ctx, access.Scopes()...)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return NewServiceFromClient(ctx, logger, client)
+}
 
+// NewServiceFromClient connects to the mailbox through a client that is
+// already authorized
+func NewServiceFromClient(ctx context.Context, logger *slog.Logger, client *http.Client) (*Service, error) {
 	svc, err := gmail.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, err
 	}
 
-	return &Service{svc: svc}, nil
+	return &Service{svc: svc, logger: logger.With("component", "gmail")}, nil
+}
+
+// Cache remembers fetched messages by ID so that messages matched by more than
+// one query are fetched only once. A nil Cache caches nothing.
+type Cache struct {
+	messages map[string]*models.Newsletter
+}
+
+// NewCache creates an empty message cache
+func NewCache() *Cache {
+	return &Cache{messages: make(map[string]*models.Newsletter)}
 }
 
-func (s *Service) FetchNewsletters(ctx context.Context, query string, maxResults int64) ([]*models.Newsletter, error) {
+// Filter returns why a message is left out of the digest, or "" to keep it
+type Filter func(n *models.Newsletter) string
+
+// FetchNewsletters returns the messages matching query that filter keeps,
+// along with the matching messages that were left out. Messages already in
+// cache are not fetched again.
+func (s *Service) FetchNewsletters(ctx context.Context, query string, maxResults int64, filter Filter, cache *Cache) ([]*models.Newsletter, []models.Skipped, error) {
 	call := s.svc.Users.Messages.List("me").Q(query).MaxResults(maxResults)
-	list, err := call.Do()
+	list, err := call.Context(ctx).Do()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	s.logger.InfoContext(ctx, "listed messages", "query", query, "matched", len(list.Messages))
 
 	var newsletters []*models.Newsletter
+	var skipped []models.Skipped
 	for _, m := range list.Messages {
-		full, err := s.svc.Users.Messages.Get("me", m.Id).Format("full").Do()
-		if err != nil {
-			continue
+		var n *models.Newsletter
+		if cache != nil {
+			n = cache.messages[m.Id]
 		}
-
-		hdr := make(map[string]string)
-		for _, h := range full.Payload.Headers {
-			hdr[h.Name] = h.Value
+		if n == nil {
+			full, err := s.svc.Users.Messages.Get("me", m.Id).Format("full").Context(ctx).Do()
+			if err != nil {
+				// Not cached, so another query matching the message retries it
+				s.logger.WarnContext(ctx, "get message failed", "message_id", m.Id, "error", err)
+				skipped = append(skipped, models.Skipped{ID: m.Id, Reason: "get message failed: " + err.Error()})
+				continue
+			}
+			n = s.parseMessage(full)
+			if cache != nil {
+				cache.messages[m.Id] = n
+			}
 		}
 
-		subj := hdr["Subject"]
-		from := hdr["From"]
-		date := hdr["Date"]
-
-		if subj == "" {
-			subj = "(no subject)"
+		// Filtered after the cache, since profiles filter differently
+		if reason := filter(n); reason != "" {
+			s.logger.DebugContext(ctx, "skipping message", "message_id", n.ID, "subject", n.Subject, "reason", reason)
+			skipped = append(skipped, models.Skipped{ID: n.ID, Subject: n.Subject, From: n.From, Reason: reason})
+			continue
 		}
+		newsletters = append(newsletters, n)
+	}
 
-		// normalize "From"
-		if a, err := mail.ParseAddress(from); err == nil && a.Name != "" {
-			from = a.Name + " <" + a.Address + ">"
-		}
+	return newsletters, skipped, nil
+}
+
+// parseMessage turns a fetched message into a newsletter
+func (s *Service) parseMessage(full *gmail.Message) *models.Newsletter {
+	hdr := make(map[string]string)
+	for _, h := range full.Payload.Headers {
+		hdr[h.Name] = h.Value
+	}
 
-		text, links := utils.PartsToTextAndLinks(full.Payload)
-		text = utils.CleanText(text)
+	subj := hdr["Subject"]
+	from := hdr["From"]
+	date := hdr["Date"]
 
-		if len(text) < 400 {
-			continue
-		}
+	if subj == "" {
+		subj = "(no subject)"
+	}
 
-		newsletters = append(newsletters, &models.Newsletter{
-			ID:      m.Id,
-			Subject: subj,
-			From:    from,
-			Date:    date,
-			Text:    text,
-			Links:   links,
-		})
+	// normalize "From"
+	if a, err := mail.ParseAddress(from); err == nil && a.Name != "" {
+		from = a.Name + " <" + a.Address + ">"
 	}
 
-	return newsletters, nil
+	text, links := utils.PartsToTextAndLinks(full.Payload)
+	text = utils.CleanText(text)
+
+	return &models.Newsletter{
+		ID:      full.Id,
+		Subject: subj,
+		From:    from,
+		ListID:  hdr["List-Id"],
+		Date:    date,
+		Text:    text,
+		Links:   links,
+	}
 }
 
 func (s *Service) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
@@ -99,8 +182,12 @@ func (s *Service) SendHTML(ctx context.Context, to, subject, htmlBody string) er
 	b.WriteString(htmlBody)
 
 	raw := base64.URLEncoding.EncodeToString([]byte(b.String()))
-	_, err := s.svc.Users.Messages.Send("me", &gmail.Message{Raw: raw}).Do()
-	return err
+	_, err := s.svc.Users.Messages.Send("me", &gmail.Message{Raw: raw}).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "digest sent", "to", to, "subject", subject, "bytes", len(htmlBody))
+	return nil
 }
 
 func (s *Service) MarkAsRead(ctx context.Context, newsletters []*models.Newsletter) error {
@@ -109,8 +196,27 @@ func (s *Service) MarkAsRead(ctx context.Context, newsletters []*models.Newslett
 		ids = append(ids, newsletter.ID)
 	}
 
+	return s.MarkIDsAsRead(ctx, ids)
+}
+
+// MarkIDsAsRead removes the UNREAD label from the given message IDs
+func (s *Service) MarkIDsAsRead(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
 	return s.svc.Users.Messages.BatchModify("me", &gmail.BatchModifyMessagesRequest{
 		Ids:            ids,
 		RemoveLabelIds: []string{"UNREAD"},
-	}).Do()
+	}).Context(ctx).Do()
+}
+
+// CheckQuery runs query against the mailbox and returns Gmail's estimate of
+// how many messages match it
+func (s *Service) CheckQuery(ctx context.Context, query string) (int64, error) {
+	list, err := s.svc.Users.Messages.List("me").Q(query).MaxResults(1).Context(ctx).Do()
+	if err != nil {
+		return 0, err
+	}
+	return list.ResultSizeEstimate, nil
 }
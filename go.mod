@@ -4,9 +4,12 @@ go 1.25
 
 require (
 	github.com/jaytaylor/html2text v0.0.0-20230321000545-74c2419ad056
+	github.com/robfig/cron/v3 v3.0.1
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/crypto v0.40.0
 	golang.org/x/oauth2 v0.30.0
 	google.golang.org/api v0.189.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,162 @@
+// Package ledger records digest runs in a local database so that an
+// interrupted run can be finished without sending the digest twice
+package ledger
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// FileName is the ledger database file inside the state directory
+const FileName = "ledger.db"
+
+var runsBucket = []byte("runs")
+
+// Status is the progress of a run
+type Status string
+
+const (
+	StatusPending  Status = "pending"  // digest built, not sent yet
+	StatusSent     Status = "sent"     // digest sent, emails not marked as read yet
+	StatusComplete Status = "complete" // digest sent and emails marked as read
+	StatusFailed   Status = "failed"   // run stopped before the digest was sent
+)
+
+// Run is one ledger entry
+type Run struct {
+	ID         string    `json:"id"`
+	Profile    string    `json:"profile,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Status     Status    `json:"status"`
+	MessageIDs []string  `json:"message_ids"`
+	DigestHash string    `json:"digest_hash,omitempty"`
+	Recipient  string    `json:"recipient,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Ledger is the run database
+type Ledger struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the ledger in dir. It fails after a short wait if
+// another process has the ledger open.
+func Open(dir string) (*Ledger, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, FileName), 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open ledger: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(runsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init ledger: %w", err)
+	}
+
+	return &Ledger{db: db}, nil
+}
+
+// OpenReadOnly opens the existing ledger in dir for reading. Other readers may
+// have it open at the same time. It fails with an error wrapping
+// fs.ErrNotExist when no run was recorded yet.
+func OpenReadOnly(dir string) (*Ledger, error) {
+	db, err := bolt.Open(filepath.Join(dir, FileName), 0600, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("open ledger: %w", err)
+	}
+	return &Ledger{db: db}, nil
+}
+
+// Close releases the database
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
+
+// NewRunID returns a unique run ID that sorts by start time
+func NewRunID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// HashDigest returns the hex SHA-256 of a digest body
+func HashDigest(html string) string {
+	sum := sha256.Sum256([]byte(html))
+	return hex.EncodeToString(sum[:])
+}
+
+// Save inserts or replaces run
+func (l *Ledger) Save(run *Run) error {
+	if run.ID == "" {
+		return errors.New("run has no ID")
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("marshal run: %w", err)
+	}
+	return l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).Put([]byte(run.ID), data)
+	})
+}
+
+// Unfinished returns the runs still in the pending or sent state, oldest first
+func (l *Ledger) Unfinished() ([]*Run, error) {
+	var runs []*Run
+	err := l.each(false, func(r *Run) bool {
+		if r.Status == StatusPending || r.Status == StatusSent {
+			runs = append(runs, r)
+		}
+		return true
+	})
+	return runs, err
+}
+
+// History returns up to limit runs, newest first. A limit of zero or less
+// returns every run.
+func (l *Ledger) History(limit int) ([]*Run, error) {
+	var runs []*Run
+	err := l.each(true, func(r *Run) bool {
+		runs = append(runs, r)
+		return limit <= 0 || len(runs) < limit
+	})
+	return runs, err
+}
+
+// each calls fn for every run in ID order until fn returns false
+func (l *Ledger) each(reverse bool, fn func(*Run) bool) error {
+	return l.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		first, step := c.First, c.Next
+		if reverse {
+			first, step = c.Last, c.Prev
+		}
+		for k, v := first(); k != nil; k, v = step() {
+			var r Run
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("decode run %s: %w", k, err)
+			}
+			if !fn(&r) {
+				break
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,117 @@
+package ledger
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	runs := []*Run{
+		{ID: "20240101T070000Z-aaaaaa", Status: StatusComplete, MessageIDs: []string{"m1"}},
+		{ID: "20240108T070000Z-bbbbbb", Status: StatusSent, MessageIDs: []string{"m2", "m3"}},
+		{ID: "20240115T070000Z-cccccc", Status: StatusFailed},
+	}
+	for _, r := range runs {
+		r.StartedAt = time.Now()
+		if err := l.Save(r); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	unfinished, err := l.Unfinished()
+	if err != nil {
+		t.Fatalf("Unfinished failed: %v", err)
+	}
+	if len(unfinished) != 1 || unfinished[0].ID != runs[1].ID {
+		t.Fatalf("Expected only the sent run to be unfinished, got %+v", unfinished)
+	}
+
+	// Completing the run removes it from the unfinished list
+	unfinished[0].Status = StatusComplete
+	if err := l.Save(unfinished[0]); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Entries survive reopening
+	l, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer l.Close()
+
+	unfinished, err = l.Unfinished()
+	if err != nil {
+		t.Fatalf("Unfinished failed: %v", err)
+	}
+	if len(unfinished) != 0 {
+		t.Errorf("Expected no unfinished runs, got %d", len(unfinished))
+	}
+
+	history, err := l.History(2)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 2 || history[0].ID != runs[2].ID || history[1].ID != runs[1].ID {
+		t.Errorf("Expected newest two runs first, got %+v", history)
+	}
+}
+
+func TestSaveRequiresID(t *testing.T) {
+	l, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer l.Close()
+
+	if err := l.Save(&Run{}); err == nil {
+		t.Error("Expected error saving a run without ID")
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenReadOnly(dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected a missing ledger to be reported as not existing, got %v", err)
+	}
+
+	l, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := l.Save(&Run{ID: "20240101T070000Z-aaaaaa", Status: StatusComplete}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	l.Close()
+
+	// Readers do not wait for each other
+	r1, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatalf("OpenReadOnly failed: %v", err)
+	}
+	defer r1.Close()
+	r2, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatalf("Second OpenReadOnly failed: %v", err)
+	}
+	defer r2.Close()
+
+	history, err := r2.History(0)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(history) != 1 {
+		t.Errorf("Expected one run, got %d", len(history))
+	}
+}
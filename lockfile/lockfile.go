@@ -0,0 +1,107 @@
+// Package lockfile provides advisory locks on files, shared between
+// processes. A lock lasts until it is released or its process exits. Locks
+// are only supported on Unix systems; elsewhere, as Supported reports,
+// acquiring a lock always succeeds without excluding anyone.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errWouldBlock is returned by lock when the lock is held and wait is false
+var errWouldBlock = errors.New("lock is held")
+
+// Lock is an acquired lock
+type Lock struct {
+	f *os.File // nil for a shared lock on a read-only directory
+}
+
+// HeldError is returned by TryAcquire when another process holds the lock
+type HeldError struct {
+	Path string
+	PID  int // process holding the lock, 0 when it is not known
+}
+
+func (e *HeldError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s is locked by another process", e.Path)
+	}
+	return fmt.Sprintf("%s is locked by process %d", e.Path, e.PID)
+}
+
+// Acquire waits for a shared or exclusive lock on path, creating the file if
+// needed. A shared lock only needs read access to the file. When the file
+// does not exist and cannot be created because its directory is read-only,
+// no process can write there and the shared lock is granted without a file.
+func Acquire(path string, shared bool) (*Lock, error) {
+	var f *os.File
+	var err error
+	if shared {
+		if f, err = os.Open(path); errors.Is(err, os.ErrNotExist) {
+			f, err = os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+			if err != nil && readOnly(err) {
+				return &Lock{}, nil
+			}
+		}
+	} else {
+		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	if err := lock(f, shared, true); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// TryAcquire takes an exclusive lock on path without waiting and records the
+// PID of this process in the file. When another process holds the lock it
+// returns a *HeldError naming that process.
+func TryAcquire(path string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+	if err := lock(f, false, false); err != nil {
+		defer f.Close()
+		if errors.Is(err, errWouldBlock) {
+			return nil, &HeldError{Path: path, PID: readPID(f)}
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("record PID in %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock. The file is left in place: removing it would
+// let another process lock a file that is no longer the one at path.
+func (l *Lock) Release() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// readPID returns the PID recorded in a lock file, or 0
+func readPID(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package lockfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Supported reports whether locks exclude other processes on this system
+const Supported = false
+
+// lock does nothing: advisory locks are only supported on Unix systems
+func lock(f *os.File, shared, wait bool) error {
+	return nil
+}
+
+// readOnly reports whether a file could not be created because its
+// directory is read-only
+func readOnly(err error) bool {
+	return errors.Is(err, fs.ErrPermission)
+}
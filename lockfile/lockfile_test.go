@@ -0,0 +1,96 @@
+//go:build unix
+
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTryAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.lock")
+
+	l, err := TryAcquire(path)
+	if err != nil {
+		t.Fatalf("TryAcquire failed: %v", err)
+	}
+
+	_, err = TryAcquire(path)
+	var held *HeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("second TryAcquire error = %v, want a HeldError", err)
+	}
+	if held.PID != os.Getpid() {
+		t.Errorf("HeldError.PID = %d, want %d", held.PID, os.Getpid())
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	l, err = TryAcquire(path)
+	if err != nil {
+		t.Fatalf("TryAcquire after Release failed: %v", err)
+	}
+	l.Release()
+}
+
+func TestAcquireShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.lock")
+
+	a, err := Acquire(path, true)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	b, err := Acquire(path, true)
+	if err != nil {
+		t.Fatalf("second shared Acquire failed: %v", err)
+	}
+
+	// An exclusive lock waits for both shared ones
+	acquired := make(chan *Lock, 1)
+	go func() {
+		l, err := Acquire(path, false)
+		if err != nil {
+			t.Errorf("exclusive Acquire failed: %v", err)
+		}
+		acquired <- l
+	}()
+	a.Release()
+	select {
+	case l := <-acquired:
+		l.Release()
+		t.Fatal("exclusive lock acquired while a shared lock is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	b.Release()
+	select {
+	case l := <-acquired:
+		if l != nil {
+			l.Release()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("exclusive lock not acquired after the shared locks were released")
+	}
+}
+
+func TestAcquireSharedReadOnlyDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0700) })
+
+	l, err := Acquire(filepath.Join(dir, "store.lock"), true)
+	if err != nil {
+		t.Fatalf("shared Acquire in a read-only directory failed: %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Errorf("Release failed: %v", err)
+	}
+}
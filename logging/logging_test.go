@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestRunIDAttached(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx := WithRunID(context.Background(), "run-123")
+	logger.With("component", "test").InfoContext(ctx, "hello", "item", "m1")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("Output is not JSON: %v (%s)", err, buf.String())
+	}
+	if rec["run_id"] != "run-123" {
+		t.Errorf("Expected run_id run-123, got %v", rec["run_id"])
+	}
+	if rec["component"] != "test" || rec["item"] != "m1" {
+		t.Errorf("Expected attributes to be kept, got %v", rec)
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "text")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	logger.Info("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("Expected info record to be filtered, got %q", buf.String())
+	}
+	logger.Warn("kept")
+	if buf.Len() == 0 {
+		t.Error("Expected warn record to be written")
+	}
+}
+
+func TestInvalidSettings(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "loud", "text"); err == nil {
+		t.Error("Expected error for invalid level")
+	}
+	if _, err := New(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("Expected error for invalid format")
+	}
+}
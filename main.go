@@ -4,152 +4,681 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
 	"syscall"
 	"time"
 
+	"newsletterdigest_go/checkpoint"
 	"newsletterdigest_go/config"
 	"newsletterdigest_go/credentials"
 	"newsletterdigest_go/gmail"
+	"newsletterdigest_go/ledger"
+	"newsletterdigest_go/lockfile"
+	"newsletterdigest_go/logging"
 	"newsletterdigest_go/models"
 	"newsletterdigest_go/openai"
+	"newsletterdigest_go/preview"
 	"newsletterdigest_go/processor"
+	"newsletterdigest_go/prompts"
+	"newsletterdigest_go/report"
+	"newsletterdigest_go/utils"
 )
 
 type App struct {
-	cfg         *config.Config
-	gmailSvc    *gmail.Service
+	cfg          *config.Config
+	gmailSvc     mailbox
 	openaiClient *openai.Client
-	processor   *processor.Processor
+	logger       *slog.Logger
+	profiles     []*profile // digests this invocation works on
+
+	reportFormat string    // dry-run report format: "text" or "json"
+	reportOut    io.Writer // where dry-run reports are written
+	resume       bool      // reuse the summaries checkpointed by an interrupted run
+
+	mu          sync.Mutex
+	runLedger   *ledger.Ledger // open while runs of this process use it
+	ledgerUsers int            // runs currently using runLedger
 }
 
-func main() {
-	config.LoadEnvFile(".env")
+// profile is one digest: its configuration and the processor built from it
+type profile struct {
+	cfg       *config.Config
+	processor digester
+	logger    *slog.Logger
+}
 
-	if handleCommand() {
-		return
-	}
+// mailbox is the Gmail access of a run, implemented by *gmail.Service
+type mailbox interface {
+	FetchNewsletters(ctx context.Context, query string, maxResults int64, filter gmail.Filter, cache *gmail.Cache) ([]*models.Newsletter, []models.Skipped, error)
+	SendHTML(ctx context.Context, to, subject, htmlBody string) error
+	MarkIDsAsRead(ctx context.Context, ids []string) error
+}
 
-	ctx, cancel := setupContext()
-	defer cancel()
+// digester summarizes newsletters into a digest, implemented by
+// *processor.Processor
+type digester interface {
+	ProcessNewsletters(ctx context.Context, newsletters []*models.Newsletter, cp *checkpoint.Checkpoint) (*processor.Result, error)
+}
 
-	app, err := initializeApp(ctx)
-	if err != nil {
-		log.Fatalf("initialization failed: %v", err)
+// version is overridden at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+func main() {
+	if err := config.LoadEnvFile(".env"); err != nil {
+		fatal(err)
 	}
 
-	if err := app.run(ctx); err != nil {
-		log.Fatalf("application error: %v", err)
+	if err := dispatch(os.Args[1:]); err != nil {
+		fatal(err)
 	}
 }
 
-func handleCommand() bool {
-	if len(os.Args) > 1 && os.Args[1] == "setup" {
-		if err := setupCredentials(); err != nil {
-			log.Fatalf("setup failed: %v", err)
-		}
-		return true
-	}
-	return false
+// fatal logs err at error level and exits. The log package would log it at
+// info level once the configured slog logger is the default.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
 }
 
 func setupContext() (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
-	
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	
+
 	go func() {
 		<-c
-		log.Println("[digest] Received shutdown signal, gracefully shutting down...")
+		slog.Info("received shutdown signal, gracefully shutting down; signal again to stop immediately")
+		signal.Stop(c)
 		cancel()
 	}()
-	
+
 	return ctx, cancel
 }
 
-func initializeApp(ctx context.Context) (*App, error) {
-	if err := credentials.ValidateEnvironment(); err != nil {
+// initializeApp builds the application for the named profiles, or for all
+// configured profiles when names is empty. access is what the commands do
+// with the mailbox.
+func initializeApp(ctx context.Context, cfg *config.Config, logger *slog.Logger, names []string, access gmail.Access) (*App, error) {
+	if err := loadSecrets(ctx); err != nil {
+		return nil, err
+	}
+	if err := credentials.ValidateSecrets(); err != nil {
 		return nil, fmt.Errorf("environment validation: %w", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation: %w", err)
+	}
+	profileCfgs, err := cfg.SelectProfiles(names)
+	if err != nil {
+		return nil, err
+	}
+	promptSets := make([]*prompts.Set, len(profileCfgs))
+	for i, pc := range profileCfgs {
+		if promptSets[i], err = prompts.Load(pc.PromptsDir); err != nil {
+			return nil, fmt.Errorf("prompt templates of profile %s: %w", pc.Profile, err)
+		}
+	}
 
-	gmailSvc, err := gmail.NewService(ctx)
+	gmailSvc, err := gmail.NewService(ctx, logger, gmailAuth(cfg), access)
 	if err != nil {
 		return nil, fmt.Errorf("gmail service: %w", err)
 	}
 
-	cfg := config.Load()
-	openaiClient := openai.NewClient()
-	proc := processor.New(openaiClient, cfg)
+	openaiClient := openai.NewClient(logger)
 
-	return &App{
+	app := &App{
 		cfg:          cfg,
 		gmailSvc:     gmailSvc,
 		openaiClient: openaiClient,
-		processor:    proc,
-	}, nil
+		logger:       logger,
+		reportOut:    os.Stdout,
+	}
+	for i, pc := range profileCfgs {
+		plog := logger.With("profile", pc.Profile)
+		app.profiles = append(app.profiles, &profile{
+			cfg:       pc,
+			processor: processor.New(openaiClient, pc, promptSets[i], plog),
+			logger:    plog,
+		})
+	}
+	return app, nil
+}
+
+// gmailAuth is how the configuration authenticates to the mailbox
+func gmailAuth(cfg *config.Config) gmail.Auth {
+	if cfg.GmailAuth == config.GmailAuthServiceAccount {
+		return gmail.Auth{Subject: cfg.GmailSubject}
+	}
+	return gmail.Auth{}
+}
+
+// runAccess is the mailbox access of a run: a dry run only reads
+func runAccess(cfg *config.Config) gmail.Access {
+	if cfg.DryRun {
+		return gmail.Access{}
+	}
+	return gmail.FullAccess
+}
+
+// openLedger opens the run ledger for a run and returns a function closing it
+// again. The database allows a single open handle, so runs of different
+// profiles in the daemon share it; it is closed once the last of them is
+// done, leaving it to history and other processes in between.
+func (app *App) openLedger() (*ledger.Ledger, func(), error) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	if app.runLedger == nil {
+		l, err := ledger.Open(app.cfg.StateDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		app.runLedger = l
+	}
+	app.ledgerUsers++
+
+	runLedger := app.runLedger
+	closeLedger := func() {
+		app.mu.Lock()
+		defer app.mu.Unlock()
+		if app.ledgerUsers--; app.ledgerUsers == 0 {
+			if err := app.runLedger.Close(); err != nil {
+				app.logger.Warn("close ledger failed", "error", err)
+			}
+			app.runLedger = nil
+		}
+	}
+	return runLedger, closeLedger, nil
 }
 
+// lockRuns takes the run lock of every profile, so that two processes, such
+// as overlapping cron runs or a run next to the daemon, never send the same
+// profile's digest at once. Dry runs change nothing and are not locked.
+func (app *App) lockRuns(profiles []*profile) (release func(), err error) {
+	if err := os.MkdirAll(app.cfg.StateDir, 0700); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	if !lockfile.Supported {
+		app.logger.Warn("file locks are not supported on this system; overlapping runs of a profile are not prevented")
+	}
+
+	var locks []*lockfile.Lock
+	release = func() {
+		for _, l := range locks {
+			l.Release()
+		}
+	}
+	for _, p := range profiles {
+		path := filepath.Join(app.cfg.StateDir, "run-"+p.cfg.Profile+".lock")
+		l, err := lockfile.TryAcquire(path)
+		if err != nil {
+			release()
+			var held *lockfile.HeldError
+			if errors.As(err, &held) && held.PID != 0 {
+				return nil, fmt.Errorf("profile %s: another digest run (PID %d) holds %s", p.cfg.Profile, held.PID, path)
+			}
+			return nil, fmt.Errorf("profile %s: %w", p.cfg.Profile, err)
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
+
+// digestRun collects what one pass of the pipeline fetched and produced
+type digestRun struct {
+	matched     []string             // IDs of every message matching the query
+	newsletters []*models.Newsletter // matching messages usable as newsletters
+	skipped     []models.Skipped     // matching messages left out while fetching
+	result      *processor.Result    // nil when there was nothing to process
+	checkpoint  *checkpoint.Checkpoint
+}
+
+// run builds and sends the digest of every profile of the invocation
 func (app *App) run(ctx context.Context) error {
-	newsletters, err := app.gmailSvc.FetchNewsletters(ctx, app.cfg.GmailQuery, app.cfg.MaxResults)
+	return app.runProfiles(ctx, app.profiles)
+}
+
+// runProfiles fetches the newsletters of all profiles first, so that messages
+// matched by several profiles are fetched once and none is marked as read
+// before every query ran, then builds and sends each profile's digest. A
+// failing profile does not stop the others.
+func (app *App) runProfiles(ctx context.Context, profiles []*profile) error {
+	runID := ledger.NewRunID()
+	ctx = logging.WithRunID(ctx, runID)
+	app.logger.InfoContext(ctx, "run started", "profiles", profileNames(profiles), "dry_run", app.cfg.DryRun)
+
+	if app.cfg.DryRun {
+		runs, err := app.fetchAll(ctx, profiles)
+		if err != nil {
+			return err
+		}
+		for i, p := range profiles {
+			if err := app.buildDigest(ctx, p, runs[i], false); err != nil {
+				return fmt.Errorf("profile %s: %w", p.cfg.Profile, err)
+			}
+			if err := app.reportDryRun(p, runs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	release, err := app.lockRuns(profiles)
 	if err != nil {
-		return fmt.Errorf("fetch newsletters: %w", err)
+		return err
 	}
+	defer release()
 
-	if len(newsletters) == 0 && !app.cfg.LinkedInOnlyMode {
-		log.Println("[digest] No unread newsletters found and LinkedIn-only mode disabled. Exiting.")
-		return nil
+	if err := app.finishUnfinishedRuns(ctx, profiles); err != nil {
+		return err
+	}
+
+	runs, err := app.fetchAll(ctx, profiles)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, p := range profiles {
+		if err := app.sendDigest(ctx, runID, p, runs[i]); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("profile %s: %w", p.cfg.Profile, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	if len(newsletters) == 0 && app.cfg.LinkedInOnlyMode {
-		log.Println("[digest] No unread newsletters found, but LinkedIn-only mode enabled. Proceeding with LinkedIn content only.")
+// sendDigest builds the digest of one profile, sends it and marks its
+// newsletters as read, recording each step in the ledger. The ledger is only
+// opened once the digest is built, since summarizing takes a while and
+// history or the runs of other profiles need the ledger meanwhile.
+func (app *App) sendDigest(ctx context.Context, runID string, p *profile, dr *digestRun) error {
+	if err := app.buildDigest(ctx, p, dr, true); err != nil || dr.result == nil {
+		return err
 	}
+	result := dr.result
 
-	digest, processedItems, err := app.processor.ProcessNewsletters(ctx, newsletters)
+	runLedger, closeLedger, err := app.openLedger()
 	if err != nil {
-		return fmt.Errorf("process newsletters: %w", err)
+		return err
+	}
+	defer closeLedger()
+
+	entry := &ledger.Run{
+		ID:         runID + "-" + p.cfg.Profile,
+		Profile:    p.cfg.Profile,
+		StartedAt:  time.Now(),
+		Status:     ledger.StatusPending,
+		DigestHash: ledger.HashDigest(result.HTML),
+		Recipient:  p.cfg.ToEmail,
+		Subject:    generateSubject(p.cfg, dr.newsletters, result.Items),
+	}
+	for _, it := range result.Items {
+		entry.MessageIDs = append(entry.MessageIDs, it.ID)
+	}
+	if err := runLedger.Save(entry); err != nil {
+		return fmt.Errorf("record run: %w", err)
 	}
 
-	subject := app.generateSubject(newsletters, processedItems)
-	if err := app.gmailSvc.SendHTML(ctx, app.cfg.ToEmail, subject, digest); err != nil {
+	if err := app.gmailSvc.SendHTML(ctx, p.cfg.ToEmail, entry.Subject, result.HTML); err != nil {
+		entry.Status = ledger.StatusFailed
+		entry.Error = err.Error()
+		entry.FinishedAt = time.Now()
+		if lerr := runLedger.Save(entry); lerr != nil {
+			p.logger.ErrorContext(ctx, "record run failed", "error", lerr)
+		}
 		return fmt.Errorf("send email: %w", err)
 	}
 
-	if err := app.markEmailsAsRead(ctx, processedItems); err != nil {
-		log.Printf("[digest] Warning: failed to mark emails as read: %v", err)
+	entry.Status = ledger.StatusSent
+	if err := runLedger.Save(entry); err != nil {
+		return fmt.Errorf("record sent run: %w", err)
+	}
+	if err := dr.checkpoint.Remove(); err != nil {
+		p.logger.WarnContext(ctx, "remove checkpoint failed", "error", err)
+	}
+
+	if err := app.gmailSvc.MarkIDsAsRead(ctx, entry.MessageIDs); err != nil {
+		p.logger.WarnContext(ctx, "mark emails as read failed, will retry on next run",
+			"message_ids", entry.MessageIDs, "error", err)
+	} else {
+		entry.Status = ledger.StatusComplete
+		entry.FinishedAt = time.Now()
+		if err := runLedger.Save(entry); err != nil {
+			p.logger.ErrorContext(ctx, "record run failed", "error", err)
+		}
+	}
+
+	p.logger.InfoContext(ctx, "run finished", "processed", len(result.Items),
+		"linkedin_posts", result.LinkedInCount, "sent_to", p.cfg.ToEmail, "status", entry.Status)
+
+	return nil
+}
+
+// finishUnfinishedRuns completes runs of profiles left behind by an
+// interrupted process, so that a digest that was sent but whose newsletters
+// were not marked as read is not digested and sent again. Sent runs only need
+// their newsletters marked as read; runs that never got to send are marked
+// failed, and their newsletters are picked up again. Runs of other profiles
+// may still be in progress in this process and are left alone.
+func (app *App) finishUnfinishedRuns(ctx context.Context, profiles []*profile) error {
+	runLedger, closeLedger, err := app.openLedger()
+	if err != nil {
+		return err
+	}
+	defer closeLedger()
+
+	runs, err := runLedger.Unfinished()
+	if err != nil {
+		return fmt.Errorf("read ledger: %w", err)
 	}
 
-	log.Printf("[digest] %s processed=%d sent_to=%s dry_run=%v",
-		time.Now().Format(time.RFC3339), len(processedItems), app.cfg.ToEmail, app.cfg.DryRun)
-	
+	names := profileNames(profiles)
+	for _, r := range runs {
+		// Runs recorded before profiles existed belong to the default profile
+		name := r.Profile
+		if name == "" {
+			name = config.DefaultProfile
+		}
+		if !slices.Contains(names, name) {
+			continue
+		}
+
+		switch r.Status {
+		case ledger.StatusPending:
+			app.logger.WarnContext(ctx, "previous run was interrupted before sending; its newsletters will be digested again",
+				"previous_run_id", r.ID)
+			r.Status = ledger.StatusFailed
+			r.Error = "interrupted before send"
+		case ledger.StatusSent:
+			app.logger.InfoContext(ctx, "previous run already sent its digest; marking its emails as read",
+				"previous_run_id", r.ID, "message_ids", r.MessageIDs)
+			if err := app.gmailSvc.MarkIDsAsRead(ctx, r.MessageIDs); err != nil {
+				return fmt.Errorf("finish run %s: mark emails as read: %w", r.ID, err)
+			}
+			r.Status = ledger.StatusComplete
+		}
+		r.FinishedAt = time.Now()
+		if err := runLedger.Save(r); err != nil {
+			return fmt.Errorf("record run %s: %w", r.ID, err)
+		}
+	}
 	return nil
 }
 
-func (app *App) generateSubject(newsletters []*models.Newsletter, processedItems []*models.Newsletter) string {
+// reportDryRun prints what run would have sent and modified for profile p
+func (app *App) reportDryRun(p *profile, dr *digestRun) error {
+	rep := &report.DryRun{
+		Profile:        p.cfg.Profile,
+		Query:          p.cfg.GmailQuery,
+		Matched:        dr.matched,
+		Skipped:        dr.skipped,
+		CacheWritesOff: app.cfg.DryRunNoCache,
+	}
+
+	if res := dr.result; res != nil {
+		rep.Included = report.Included(res.Items)
+		rep.Skipped = append(rep.Skipped, res.Skipped...)
+		rep.LinkedInPosts = res.LinkedInCount
+		rep.FilteredPosts = res.FilteredPosts
+		rep.Email = &report.Email{
+			To:         p.cfg.ToEmail,
+			Subject:    generateSubject(p.cfg, dr.newsletters, res.Items),
+			DigestType: res.DigestType,
+			Bytes:      len(res.HTML),
+			Fallback:   res.Fallback,
+		}
+		for _, it := range res.Items {
+			rep.WouldMarkRead = append(rep.WouldMarkRead, it.ID)
+		}
+	}
+
+	if app.reportFormat == "json" {
+		return rep.WriteJSON(app.reportOut)
+	}
+	return rep.WriteText(app.reportOut)
+}
+
+// preview builds the digest of each profile and writes it to outDir, in a
+// subdirectory per profile when there are several, or serves the digest of a
+// single profile on a local port when port is non-zero, rendering it again
+// whenever a prompt template in the profile's PromptsDir changes. It never
+// sends mail or marks emails as read.
+func (app *App) preview(ctx context.Context, outDir string, port int) error {
+	if port != 0 {
+		if len(app.profiles) != 1 {
+			return errors.New("serving a preview needs a single profile (--profile)")
+		}
+		p := app.profiles[0]
+		srv := preview.NewServer(func(ctx context.Context) (*processor.Result, error) {
+			// Pick up the prompt templates edited since the last render
+			set, err := prompts.Load(p.cfg.PromptsDir)
+			if err != nil {
+				return nil, err
+			}
+			p.processor = processor.New(app.openaiClient, p.cfg, set, p.logger)
+
+			dr, err := app.fetchNewsletters(ctx, p, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := app.buildDigest(ctx, p, dr, false); err != nil {
+				return nil, err
+			}
+			if dr.result == nil {
+				return nil, errors.New("no newsletters matched the query")
+			}
+			return dr.result, nil
+		}, func() string { return prompts.Stamp(p.cfg.PromptsDir) }, p.logger)
+		return srv.ListenAndServe(ctx, port)
+	}
+
+	runs, err := app.fetchAll(ctx, app.profiles)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range app.profiles {
+		dr := runs[i]
+		if err := app.buildDigest(ctx, p, dr, false); err != nil {
+			return fmt.Errorf("profile %s: %w", p.cfg.Profile, err)
+		}
+		if dr.result == nil {
+			continue
+		}
+
+		dir := outDir
+		if len(app.profiles) > 1 {
+			dir = filepath.Join(outDir, p.cfg.Profile)
+		}
+		if err := preview.Write(dir, dr.result); err != nil {
+			return err
+		}
+
+		p.logger.InfoContext(ctx, "preview written", "dir", dir, "processed", len(dr.result.Items),
+			"linkedin_posts", dr.result.LinkedInCount, "fallback", dr.result.Fallback)
+	}
+	return nil
+}
+
+// fetchAll fetches the newsletters of every profile. Messages matched by
+// several profiles are fetched once.
+func (app *App) fetchAll(ctx context.Context, profiles []*profile) ([]*digestRun, error) {
+	cache := gmail.NewCache()
+	runs := make([]*digestRun, len(profiles))
+	for i, p := range profiles {
+		dr, err := app.fetchNewsletters(ctx, p, cache)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", p.cfg.Profile, err)
+		}
+		runs[i] = dr
+	}
+	return runs, nil
+}
+
+// fetchNewsletters fetches the newsletters matching the query of profile p
+func (app *App) fetchNewsletters(ctx context.Context, p *profile, cache *gmail.Cache) (*digestRun, error) {
+	newsletters, skipped, err := app.gmailSvc.FetchNewsletters(ctx, p.cfg.GmailQuery, p.cfg.MaxResults, newsletterFilter(p.cfg), cache)
+	if err != nil {
+		return nil, fmt.Errorf("fetch newsletters: %w", err)
+	}
+
+	dr := &digestRun{newsletters: newsletters, skipped: skipped}
+	for _, n := range newsletters {
+		dr.matched = append(dr.matched, n.ID)
+	}
+	for _, s := range skipped {
+		dr.matched = append(dr.matched, s.ID)
+	}
+	return dr, nil
+}
+
+// newsletterFilter leaves out the messages a sender rule excludes and those
+// too short to summarize, unless a sender rule always includes them
+func newsletterFilter(cfg *config.Config) gmail.Filter {
+	return func(n *models.Newsletter) string {
+		rule := cfg.SenderRule(n.From, n.ListID)
+		switch {
+		case rule != nil && rule.Include == config.IncludeNever:
+			return "excluded by sender rule"
+		case utils.CleanText(n.Text) == "":
+			// Nothing to summarize, even for newsletters always included
+			return "empty body"
+		case rule != nil && rule.Include == config.IncludeAlways:
+			return ""
+		case len(n.Text) < cfg.MinTextChars:
+			return fmt.Sprintf("body too short (%d < %d chars)", len(n.Text), cfg.MinTextChars)
+		}
+		return ""
+	}
+}
+
+// buildDigest renders the digest of profile p from the fetched newsletters in
+// dr. With useCheckpoint, summaries are checkpointed in the state directory as
+// they complete, and with app.resume a checkpoint for the same newsletters is
+// picked up where it was left.
+func (app *App) buildDigest(ctx context.Context, p *profile, dr *digestRun, useCheckpoint bool) error {
+	if len(dr.newsletters) == 0 && !p.cfg.LinkedInOnlyMode {
+		p.logger.InfoContext(ctx, "no unread newsletters found and LinkedIn-only mode disabled, nothing to do",
+			"skipped", len(dr.skipped))
+		return nil
+	}
+
+	if len(dr.newsletters) == 0 && p.cfg.LinkedInOnlyMode {
+		p.logger.InfoContext(ctx, "no unread newsletters found, proceeding with LinkedIn content only")
+	}
+
+	var err error
+	if useCheckpoint {
+		if dr.checkpoint, err = app.openCheckpoint(ctx, p, dr.newsletters); err != nil {
+			return err
+		}
+	}
+
+	dr.result, err = p.processor.ProcessNewsletters(ctx, dr.newsletters, dr.checkpoint)
+	if err != nil {
+		return fmt.Errorf("process newsletters: %w", err)
+	}
+	return nil
+}
+
+// openCheckpoint returns the checkpoint to record the summaries of newsletters
+// in, resuming the existing one when asked to and it matches newsletters
+func (app *App) openCheckpoint(ctx context.Context, p *profile, newsletters []*models.Newsletter) (*checkpoint.Checkpoint, error) {
+	ids := make([]string, len(newsletters))
+	for i, n := range newsletters {
+		ids[i] = n.ID
+	}
+
+	if app.resume {
+		cp, err := checkpoint.Load(app.cfg.StateDir, p.cfg.Profile, ids)
+		if err != nil {
+			return nil, err
+		}
+		if cp != nil {
+			p.logger.InfoContext(ctx, "resuming from checkpoint", "created_at", cp.CreatedAt,
+				"newsletters_done", len(cp.Newsletters), "posts_done", len(cp.Posts))
+			return cp, nil
+		}
+		p.logger.InfoContext(ctx, "no checkpoint for these newsletters, starting from scratch")
+	}
+	return checkpoint.New(app.cfg.StateDir, p.cfg.Profile, ids), nil
+}
+
+func profileNames(profiles []*profile) []string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.cfg.Profile
+	}
+	return names
+}
+
+func generateSubject(cfg *config.Config, newsletters []*models.Newsletter, processedItems []*models.Newsletter) string {
+	title := "LinkedIn Industry Digest"
 	if len(newsletters) > 0 && len(processedItems) > 0 {
-		return "Weekly Digest - " + time.Now().Format("2006-01-02")
+		title = "Weekly Digest"
 	}
-	return "LinkedIn Industry Digest - " + time.Now().Format("2006-01-02")
+	// Tell apart the digests of several profiles sent to the same inbox
+	if cfg.Profile != config.DefaultProfile {
+		title += " (" + cfg.Profile + ")"
+	}
+	return title + " - " + time.Now().Format("2006-01-02")
 }
 
-func (app *App) markEmailsAsRead(ctx context.Context, processedItems []*models.Newsletter) error {
-	if app.cfg.DryRun {
+// loadSecrets resolves every secret and fills those the environment leaves
+// unset from the credential store. Only the commands that use the API keys
+// call it, so that the others run no secret helper and decrypt nothing.
+func loadSecrets(ctx context.Context) error {
+	if err := config.ResolveSecrets(ctx); err != nil {
+		return err
+	}
+	if err := loadStoredSecrets(); err != nil {
+		return fmt.Errorf("load stored secrets: %w", err)
+	}
+	return nil
+}
+
+// resolvePassphrase resolves only CREDENTIALS_PASSPHRASE, for the commands
+// that manage the credential store
+func resolvePassphrase() error {
+	return config.ResolveSecrets(context.Background(), "CREDENTIALS_PASSPHRASE")
+}
+
+// loadStoredSecrets fills the secrets missing from the environment from the
+// credential store
+func loadStoredSecrets() error {
+	if config.Secret("CREDENTIALS_PASSPHRASE") == "" {
 		return nil
 	}
-	return app.gmailSvc.MarkAsRead(ctx, processedItems)
+	store, err := credentials.NewStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	stored, err := store.Secrets()
+	if err != nil {
+		return err
+	}
+	config.FillSecrets(stored, credentials.SecretsSource)
+	return nil
 }
 
-func setupCredentials() error {
+func setupCredentials(ctx context.Context, credPath string, auth credentials.AuthOptions, access gmail.Access) error {
 	store, err := credentials.NewStoreFromEnv()
 	if err != nil {
 		return err
 	}
 
-	credPath := os.Getenv("GOOGLE_CREDENTIALS_FILE")
 	if credPath == "" {
-		return errors.New("GOOGLE_CREDENTIALS_FILE environment variable required for setup")
+		return errors.New("GOOGLE_CREDENTIALS_FILE environment variable or --credentials-file flag required for setup (or --service-account-file for a service account)")
 	}
 
 	if err := store.SetupFromFile(credPath); err != nil {
@@ -157,7 +686,28 @@ func setupCredentials() error {
 	}
 
 	log.Println("Credentials stored securely!")
+
+	if err := store.Authorize(ctx, auth, access.Scopes()...); err != nil {
+		return fmt.Errorf("authorize Gmail access: %w", err)
+	}
+	log.Println("Gmail access authorized and token stored")
 	log.Println("You can now delete the original credentials.json file")
 	log.Println("Set CREDENTIALS_PASSPHRASE environment variable for future runs")
 	return nil
 }
+
+// setupServiceAccount stores a service account key for domain-wide
+// delegation; no browser authorization is needed
+func setupServiceAccount(keyPath string) error {
+	store, err := credentials.NewStoreFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := store.SetupServiceAccountFromFile(keyPath); err != nil {
+		return err
+	}
+	log.Println("Service account key stored securely!")
+	log.Println("You can now delete the original key file")
+	log.Println("Set GMAIL_AUTH=service_account and GMAIL_SUBJECT to the mailbox to read")
+	return nil
+}
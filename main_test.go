@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"newsletterdigest_go/checkpoint"
+	"newsletterdigest_go/config"
+	"newsletterdigest_go/gmail"
+	"newsletterdigest_go/logging"
+	"newsletterdigest_go/models"
+	"newsletterdigest_go/processor"
+	"newsletterdigest_go/report"
+)
+
+// fakeMailbox serves messages and records every change made to the mailbox
+type fakeMailbox struct {
+	messages   []*models.Newsletter
+	sent       []string // subjects of the sent digests
+	markedRead []string
+}
+
+func (m *fakeMailbox) FetchNewsletters(ctx context.Context, query string, maxResults int64, filter gmail.Filter, cache *gmail.Cache) ([]*models.Newsletter, []models.Skipped, error) {
+	var newsletters []*models.Newsletter
+	var skipped []models.Skipped
+	for _, n := range m.messages {
+		if reason := filter(n); reason != "" {
+			skipped = append(skipped, models.Skipped{ID: n.ID, Subject: n.Subject, From: n.From, Reason: reason})
+			continue
+		}
+		newsletters = append(newsletters, n)
+	}
+	return newsletters, skipped, nil
+}
+
+func (m *fakeMailbox) SendHTML(ctx context.Context, to, subject, htmlBody string) error {
+	m.sent = append(m.sent, subject)
+	return nil
+}
+
+func (m *fakeMailbox) MarkIDsAsRead(ctx context.Context, ids []string) error {
+	m.markedRead = append(m.markedRead, ids...)
+	return nil
+}
+
+// fakeDigester digests every newsletter without calling a model
+type fakeDigester struct{}
+
+func (fakeDigester) ProcessNewsletters(ctx context.Context, newsletters []*models.Newsletter, cp *checkpoint.Checkpoint) (*processor.Result, error) {
+	return &processor.Result{
+		HTML:          "<html><body>digest</body></html>",
+		Items:         newsletters,
+		LinkedInCount: 2,
+		DigestType:    "newsletters",
+		FilteredPosts: []processor.FilteredPost{{Author: "Vendor", URL: "https://linkedin.example/p/1", Reason: "promotional"}},
+	}, nil
+}
+
+func testApp(t *testing.T, cfg *config.Config, mb *fakeMailbox) (*App, *bytes.Buffer) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	app := &App{cfg: cfg, gmailSvc: mb, logger: logging.Discard(), reportOut: out}
+	for _, pc := range cfg.ProfileConfigs() {
+		app.profiles = append(app.profiles, &profile{cfg: pc, processor: fakeDigester{}, logger: app.logger})
+	}
+	return app, out
+}
+
+func TestDryRunHasNoSideEffects(t *testing.T) {
+	long := strings.Repeat("newsletter text ", 50)
+	messages := []*models.Newsletter{
+		{ID: "m1", Subject: "Weekly notes", From: "news@example.com", Text: long},
+		{ID: "m2", Subject: "Teaser", From: "short@example.com", Text: "too short"},
+	}
+
+	tests := []struct {
+		format string
+		check  func(t *testing.T, out string)
+	}{
+		{"text", func(t *testing.T, out string) {
+			for _, want := range []string{
+				"=== Dry run report: default ===",
+				"Matched messages: 2",
+				"  m1  Weekly notes — news@example.com",
+				"  m2  Teaser: body too short (9 < 400 chars)",
+				"LinkedIn posts included: 2",
+				"  Vendor  https://linkedin.example/p/1: promotional",
+				"  to:      me@example.com",
+				"Would mark as read (1): m1",
+			} {
+				if !strings.Contains(out, want) {
+					t.Errorf("Expected %q in the report:\n%s", want, out)
+				}
+			}
+		}},
+		{"json", func(t *testing.T, out string) {
+			var rep report.DryRun
+			if err := json.Unmarshal([]byte(out), &rep); err != nil {
+				t.Fatalf("Report is not JSON: %v\n%s", err, out)
+			}
+			if len(rep.Matched) != 2 || len(rep.Included) != 1 || len(rep.Skipped) != 1 || rep.Email == nil || rep.Email.To != "me@example.com" {
+				t.Errorf("Unexpected report %+v", rep)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ToEmail = "me@example.com"
+			cfg.DryRun = true
+			cfg.StateDir = t.TempDir()
+			mb := &fakeMailbox{messages: messages}
+			app, out := testApp(t, cfg, mb)
+			app.reportFormat = tt.format
+
+			if err := app.run(context.Background()); err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			if len(mb.sent) != 0 || len(mb.markedRead) != 0 {
+				t.Errorf("Dry run changed the mailbox: sent %v, marked as read %v", mb.sent, mb.markedRead)
+			}
+			// No ledger, run lock or checkpoint is written
+			if entries, err := os.ReadDir(cfg.StateDir); err != nil || len(entries) != 0 {
+				t.Errorf("Dry run wrote to the state directory: %v, %v", entries, err)
+			}
+			tt.check(t, out.String())
+		})
+	}
+}
+
+func TestNewsletterFilter(t *testing.T) {
+	cfg := config.Default()
+	cfg.MinTextChars = 20
+	cfg.Senders = []config.SenderRule{
+		{From: "noise@example.com", Include: config.IncludeNever},
+		{From: "vip@example.com", Include: config.IncludeAlways},
+	}
+	filter := newsletterFilter(cfg)
+
+	long := strings.Repeat("x", 30)
+	tests := []struct {
+		name string
+		n    *models.Newsletter
+		want string
+	}{
+		{"long enough", &models.Newsletter{From: "news@example.com", Text: long}, ""},
+		{"too short", &models.Newsletter{From: "news@example.com", Text: "short"}, "body too short (5 < 20 chars)"},
+		{"excluded sender", &models.Newsletter{From: "noise@example.com", Text: long}, "excluded by sender rule"},
+		{"always included though short", &models.Newsletter{From: "vip@example.com", Text: "short"}, ""},
+		{"empty body", &models.Newsletter{From: "news@example.com", Text: " \n "}, "empty body"},
+		{"always included with empty body", &models.Newsletter{From: "vip@example.com", Text: "\t\n"}, "empty body"},
+	}
+	for _, tt := range tests {
+		if got := filter(tt.n); got != tt.want {
+			t.Errorf("%s: filter = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -4,7 +4,16 @@ type Newsletter struct {
 	ID      string
 	Subject string
 	From    string
+	ListID  string // List-Id header, empty for messages not sent to a list
 	Date    string
 	Text    string
 	Links   []string
 }
+
+// Skipped records an input item that was left out of the digest and why
+type Skipped struct {
+	ID      string `json:"id"`
+	Subject string `json:"subject,omitempty"`
+	From    string `json:"from,omitempty"`
+	Reason  string `json:"reason"`
+}
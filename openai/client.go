@@ -1,22 +1,33 @@
 package openai
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"math"
 	"math/rand"
 	"net/http"
-	"os"
-	"strings"
+	"net/url"
 	"time"
 
 	"newsletterdigest_go/config"
 )
 
-type Client struct{}
+type Client struct {
+	retry  Retry
+	logger *slog.Logger
+}
+
+// Retry controls how failed requests are retried
+type Retry struct {
+	Max        int           // attempts per request
+	BackoffMin time.Duration // backoff after the first attempt, doubled per attempt
+	BackoffMax time.Duration
+}
 
 // ChatMessage is exported for use by other packages
 type ChatMessage struct {
@@ -43,18 +54,60 @@ type chatResp struct {
 	} `json:"content"`
 }
 
-func NewClient() *Client {
-	return &Client{}
+func NewClient(logger *slog.Logger) *Client {
+	return &Client{
+		retry:  Retry{Max: config.RetryMax, BackoffMin: config.BackoffMin, BackoffMax: config.BackoffMax},
+		logger: logger.With("component", "claude"),
+	}
+}
+
+// WithRetry returns a copy of the client that retries according to r
+func (c *Client) WithRetry(r Retry) *Client {
+	cp := *c
+	cp.retry = r
+	return &cp
+}
+
+// CheckModel verifies that the API key is accepted and that model exists,
+// without generating any tokens
+func (c *Client) CheckModel(ctx context.Context, model string) error {
+	apiKey := config.Secret("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return errors.New("missing ANTHROPIC_API_KEY")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.anthropic.com/v1/models/"+url.PathEscape(model), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return errors.New("API key rejected")
+	case http.StatusNotFound:
+		return fmt.Errorf("model %q not found", model)
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("claude status %d: %s", resp.StatusCode, string(body))
+	}
 }
 
 func (c *Client) Chat(ctx context.Context, model string, messages []ChatMessage, temp float64, maxTok int) (string, error) {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	apiKey := config.Secret("ANTHROPIC_API_KEY")
 	if apiKey == "" {
 		return "", errors.New("missing ANTHROPIC_API_KEY")
 	}
 
-	// Calling Claude API
-
 	// Convert messages and extract system message
 	var systemMsg string
 	var claudeMessages []claudeMessage
@@ -78,21 +131,31 @@ func (c *Client) Chat(ctx context.Context, model string, messages []ChatMessage,
 		System:      systemMsg,
 	}
 
-	b, _ := json.Marshal(reqBody)
-	req, _ := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", strings.NewReader(string(b)))
-	req.Header.Set("x-api-key", apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("Content-Type", "application/json")
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
 
 	var lastErr error
-	for attempt := 1; attempt <= config.RetryMax; attempt++ {
+	for attempt := 1; attempt <= c.retry.Max; attempt++ {
+		// A request body can only be read once, so each attempt needs its own request
+		req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(b))
+		if err != nil {
+			return "", fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("x-api-key", apiKey)
+		req.Header.Set("anthropic-version", "2023-06-01")
+		req.Header.Set("Content-Type", "application/json")
+
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			lastErr = err
 		} else {
-			defer resp.Body.Close()
-			body, _ := io.ReadAll(resp.Body)
-			if resp.StatusCode == 200 {
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				lastErr = fmt.Errorf("read response: %w", err)
+			} else if resp.StatusCode == 200 {
 				var cr chatResp
 				if err := json.Unmarshal(body, &cr); err != nil {
 					return "", err
@@ -101,18 +164,31 @@ func (c *Client) Chat(ctx context.Context, model string, messages []ChatMessage,
 					return "", errors.New("no content in response")
 				}
 				return cr.Content[0].Text, nil
-			}
-			// Retry on 429/5xx
-			if resp.StatusCode == 429 || (resp.StatusCode >= 500 && resp.StatusCode <= 599) {
+			} else if resp.StatusCode == 429 || (resp.StatusCode >= 500 && resp.StatusCode <= 599) {
+				// Retry on 429/5xx
 				lastErr = fmt.Errorf("claude status %d: %s", resp.StatusCode, string(body))
 			} else {
 				return "", fmt.Errorf("claude status %d: %s", resp.StatusCode, string(body))
 			}
 		}
 
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
 		// backoff
-		sleep := time.Duration(math.Min(float64(config.BackoffMax), float64(config.BackoffMin)*math.Pow(2, float64(attempt-1)))) + time.Duration(rand.Intn(700))*time.Millisecond
-		time.Sleep(sleep)
+		if attempt == c.retry.Max {
+			break
+		}
+		sleep := time.Duration(math.Min(float64(c.retry.BackoffMax), float64(c.retry.BackoffMin)*math.Pow(2, float64(attempt-1)))) + time.Duration(rand.Intn(700))*time.Millisecond
+		c.logger.WarnContext(ctx, "claude request failed, retrying",
+			"model", model, "attempt", attempt, "max_attempts", c.retry.Max, "backoff", sleep, "error", lastErr)
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(sleep):
+		}
 	}
 	return "", lastErr
 }
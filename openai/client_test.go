@@ -6,6 +6,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"newsletterdigest_go/logging"
 )
 
 func TestClaudeAPIConnection(t *testing.T) {
@@ -14,7 +16,7 @@ func TestClaudeAPIConnection(t *testing.T) {
 		t.Skip("ANTHROPIC_API_KEY not set, skipping integration test")
 	}
 
-	client := NewClient()
+	client := NewClient(logging.Discard())
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -47,7 +49,7 @@ func TestClaudeWithSystemMessage(t *testing.T) {
 		t.Skip("ANTHROPIC_API_KEY not set, skipping integration test")
 	}
 
-	client := NewClient()
+	client := NewClient(logging.Discard())
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -0,0 +1,259 @@
+// Package preview renders digests locally instead of emailing them
+package preview
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"newsletterdigest_go/processor"
+	"newsletterdigest_go/utils"
+)
+
+// File names written by Write
+const (
+	DigestFile    = "digest.html"
+	RawTextFile   = "model-output.txt"
+	SummariesFile = "summaries.txt"
+)
+
+// Write stores the digest HTML, the raw model output and the per-item
+// summaries of res in dir, creating the directory if needed
+func Write(dir string, res *processor.Result) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create preview dir: %w", err)
+	}
+
+	files := map[string]string{
+		DigestFile:    res.HTML,
+		RawTextFile:   res.RawText,
+		SummariesFile: strings.Join(res.Summaries, processor.Separator),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// RenderFunc produces a fresh digest
+type RenderFunc func(ctx context.Context) (*processor.Result, error)
+
+// StampFunc returns a value that changes whenever the inputs of a render do,
+// such as the prompt template files
+type StampFunc func() string
+
+// watchInterval is how often the server checks its stamp for changes
+const watchInterval = 2 * time.Second
+
+// Server serves the latest rendered digest on a local port. Open pages poll
+// for a new version and reload themselves after each re-render.
+type Server struct {
+	render RenderFunc
+	stamp  StampFunc
+	logger *slog.Logger
+
+	renderMu sync.Mutex // renders run one at a time
+
+	mu      sync.RWMutex
+	result  *processor.Result
+	version int
+	lastErr error
+}
+
+// NewServer creates a preview server around render. When stamp is not nil,
+// the digest is rendered again whenever the value it returns changes.
+func NewServer(render RenderFunc, stamp StampFunc, logger *slog.Logger) *Server {
+	return &Server{render: render, stamp: stamp, logger: logger.With("component", "preview")}
+}
+
+// Render runs the render function and publishes its result to open pages
+func (s *Server) Render(ctx context.Context) error {
+	s.renderMu.Lock()
+	defer s.renderMu.Unlock()
+
+	res, err := s.render(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "render failed", "error", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastErr = err
+	if err == nil {
+		s.result = res
+	}
+	s.version++
+	return err
+}
+
+// ListenAndServe renders the digest once and serves it on 127.0.0.1:port
+// until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context, port int) error {
+	var stamp string
+	if s.stamp != nil {
+		stamp = s.stamp()
+	}
+	// A failed render is logged by Render and shown on the page
+	s.Render(ctx)
+
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	srv := &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			s.logger.Warn("shutdown failed", "error", err)
+		}
+	}()
+	if s.stamp != nil {
+		go s.watch(ctx, stamp)
+	}
+
+	s.logger.Info("serving preview", "url", "http://"+ln.Addr().String(), "rerender", "POST /_rerender")
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// watch renders the digest again each time the stamp changes from last,
+// until ctx is cancelled
+func (s *Server) watch(ctx context.Context, last string) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if stamp := s.stamp(); stamp != last {
+			last = stamp
+			s.logger.InfoContext(ctx, "inputs changed, rendering again")
+			s.Render(ctx)
+		}
+	}
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleDigest)
+	mux.HandleFunc("/raw", s.handleText(func(r *processor.Result) string { return r.RawText }))
+	mux.HandleFunc("/summaries", s.handleText(func(r *processor.Result) string {
+		return strings.Join(r.Summaries, processor.Separator)
+	}))
+	mux.HandleFunc("/_version", s.handleVersion)
+	mux.HandleFunc("/_rerender", s.handleRerender)
+	return mux
+}
+
+func (s *Server) handleDigest(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	res, version, lastErr := s.result, s.version, s.lastErr
+	s.mu.RUnlock()
+
+	var page string
+	switch {
+	case lastErr != nil:
+		page = "<html><body><h1>Render failed</h1><pre>" + utils.HtmlEscape(lastErr.Error()) + "</pre></body></html>"
+	case res == nil:
+		page = "<html><body><p>Rendering…</p></body></html>"
+	default:
+		page = res.HTML
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, injectReload(page, version))
+}
+
+func (s *Server) handleText(field func(*processor.Result) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		res := s.result
+		s.mu.RUnlock()
+
+		if res == nil {
+			http.Error(w, "no digest rendered yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, field(res))
+	}
+}
+
+func (s *Server) handleRerender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	// Every render costs model calls, so other web pages open in the
+	// browser must not be able to trigger one
+	if !fromLoopback(r) {
+		http.Error(w, "re-render only from the preview page or a local client", http.StatusForbidden)
+		return
+	}
+	if err := s.Render(context.WithoutCancel(r.Context())); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// fromLoopback reports whether r was addressed to a loopback host and, when
+// it comes from a browser, from a page of this server. The Host check keeps
+// out DNS rebinding; clients such as curl send no Origin.
+func fromLoopback(r *http.Request) bool {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	return origin == "" || origin == "http://"+r.Host
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	version := s.version
+	s.mu.RUnlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, version)
+}
+
+// injectReload adds a script that reloads the page once the server reports a
+// newer version than the one it was rendered with
+func injectReload(page string, version int) string {
+	script := fmt.Sprintf(`<script>
+(function(){var v=%d;setInterval(function(){fetch("/_version",{cache:"no-store"}).then(function(r){return r.text()}).then(function(t){if(parseInt(t,10)!==v){location.reload()}}).catch(function(){})},2000)})();
+</script>
+`, version)
+
+	if i := strings.LastIndex(page, "</body>"); i != -1 {
+		return page[:i] + script + page[i:]
+	}
+	return page + script
+}
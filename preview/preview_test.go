@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"newsletterdigest_go/logging"
+	"newsletterdigest_go/processor"
+)
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "preview")
+	res := &processor.Result{
+		HTML:      "<html><body>digest</body></html>",
+		RawText:   "model output",
+		Summaries: []string{"first", "second"},
+	}
+	if err := Write(dir, res); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		DigestFile:    res.HTML,
+		RawTextFile:   res.RawText,
+		SummariesFile: "first" + processor.Separator + "second",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("ReadFile(%s) failed: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestInjectReload(t *testing.T) {
+	page := injectReload("<html><body><p>digest</p></body></html>", 3)
+	if !strings.HasSuffix(page, "</script>\n</body></html>") {
+		t.Errorf("Expected the script right before </body>, got %q", page)
+	}
+	if !strings.Contains(page, "var v=3;") || !strings.Contains(page, `fetch("/_version"`) {
+		t.Errorf("Expected the script to poll /_version against version 3, got %q", page)
+	}
+
+	// Fragments without a body get the script appended
+	if page := injectReload("<p>digest</p>", 1); !strings.HasPrefix(page, "<p>digest</p><script>") {
+		t.Errorf("Expected the script after the fragment, got %q", page)
+	}
+}
+
+func TestRerenderChecksOrigin(t *testing.T) {
+	renders := 0
+	s := NewServer(func(context.Context) (*processor.Result, error) {
+		renders++
+		return &processor.Result{HTML: "digest"}, nil
+	}, nil, logging.Discard())
+	h := s.handler()
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   int
+	}{
+		{"local client", "127.0.0.1:8080", "", http.StatusOK},
+		{"preview page", "127.0.0.1:8080", "http://127.0.0.1:8080", http.StatusOK},
+		{"localhost page", "localhost:8080", "http://localhost:8080", http.StatusOK},
+		{"other web page", "127.0.0.1:8080", "https://example.com", http.StatusForbidden},
+		{"other local port", "127.0.0.1:8080", "http://127.0.0.1:3000", http.StatusForbidden},
+		{"sandboxed page", "127.0.0.1:8080", "null", http.StatusForbidden},
+		{"rebound host name", "attacker.example:8080", "http://attacker.example:8080", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/_rerender", nil)
+		req.Host = tt.host
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+	if renders != 3 {
+		t.Errorf("Expected 3 renders, got %d", renders)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_rerender", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
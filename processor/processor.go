@@ -3,14 +3,17 @@ package processor
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
+	"newsletterdigest_go/checkpoint"
 	"newsletterdigest_go/config"
 	"newsletterdigest_go/fetcher"
 	"newsletterdigest_go/models"
 	"newsletterdigest_go/openai"
+	"newsletterdigest_go/prompts"
 	"newsletterdigest_go/utils"
 	"newsletterdigest_go/validator"
 )
@@ -21,47 +24,113 @@ type Processor struct {
 	openaiClient   *openai.Client
 	config         *config.Config
 	contentFetcher *fetcher.ContentFetcher
+	prompts        *prompts.Set
+	logger         *slog.Logger
 }
 
-func New(client *openai.Client, cfg *config.Config) *Processor {
+// Result holds the digest produced by ProcessNewsletters together with the
+// intermediate outputs it was built from
+type Result struct {
+	HTML          string               // complete digest document
+	RawText       string               // plain-text synthesis output before HTML conversion
+	Summaries     []string             // per-newsletter and per-post summaries fed into the synthesis
+	Items         []*models.Newsletter // newsletters that were summarized
+	LinkedInCount int
+	DigestType    string
+	Fallback      bool             // synthesis failed and HTML holds the raw summaries
+	Skipped       []models.Skipped // newsletters that could not be summarized
+	FilteredPosts []FilteredPost   // LinkedIn posts left out of the digest
+}
+
+// FilteredPost records a LinkedIn post that was left out of the digest and why
+type FilteredPost struct {
+	Author string `json:"author"`
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+func New(client *openai.Client, cfg *config.Config, set *prompts.Set, logger *slog.Logger) *Processor {
+	contentFetcher := fetcher.New(logger, fetcher.Limits{MaxAge: cfg.LinkedInMaxAge, ArticleMaxChars: cfg.ArticleMaxChars})
+	if cfg.DryRun && cfg.DryRunNoCache {
+		contentFetcher.DisableCacheWrites()
+	}
+
 	return &Processor{
-		openaiClient:   client,
+		openaiClient:   client.WithRetry(openai.Retry{Max: cfg.RetryMax, BackoffMin: cfg.BackoffMin, BackoffMax: cfg.BackoffMax}),
 		config:         cfg,
-		contentFetcher: fetcher.New(),
+		contentFetcher: contentFetcher,
+		prompts:        set,
+		logger:         logger.With("component", "processor"),
 	}
 }
 
-func (p *Processor) ProcessNewsletters(ctx context.Context, newsletters []*models.Newsletter) (string, []*models.Newsletter, error) {
+// ProcessNewsletters summarizes the newsletters and LinkedIn posts and
+// synthesizes the digest. Summaries found in cp are reused, and new ones are
+// saved to it as they complete; cp may be nil.
+func (p *Processor) ProcessNewsletters(ctx context.Context, newsletters []*models.Newsletter, cp *checkpoint.Checkpoint) (*Result, error) {
 	var perSummaries []string
 	var processedItems []*models.Newsletter
+	var skipped []models.Skipped
+
+	newsletters = p.byPriority(newsletters)
 
 	// Process newsletters if available
-	if len(newsletters) > 0 {
-		for _, newsletter := range newsletters {
-			summary, err := p.summarizeSingle(ctx, newsletter)
+	for _, newsletter := range newsletters {
+		// Stop instead of recording every remaining newsletter as failed
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		summary, ok := cp.Newsletter(newsletter.ID)
+		if ok {
+			p.logger.DebugContext(ctx, "reusing checkpointed summary", "message_id", newsletter.ID, "subject", newsletter.Subject)
+		} else {
+			var err error
+			summary, err = p.summarizeSingle(ctx, newsletter)
 			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				p.logger.WarnContext(ctx, "summarize newsletter failed",
+					"message_id", newsletter.ID, "subject", newsletter.Subject, "error", err)
+				skipped = append(skipped, models.Skipped{
+					ID:      newsletter.ID,
+					Subject: newsletter.Subject,
+					From:    newsletter.From,
+					Reason:  "summarize failed: " + err.Error(),
+				})
 				continue
 			}
+			if err := cp.SaveNewsletter(newsletter.ID, summary); err != nil {
+				p.logger.WarnContext(ctx, "save checkpoint failed", "message_id", newsletter.ID, "error", err)
+			}
+			p.logger.DebugContext(ctx, "summarized newsletter", "message_id", newsletter.ID, "subject", newsletter.Subject)
 
-			perSummaries = append(perSummaries, fmt.Sprintf("### %s\n%s\nLinks:\n%s",
-				newsletter.Subject, summary, strings.Join(newsletter.Links, "\n")))
-			processedItems = append(processedItems, newsletter)
-
-			time.Sleep(p.config.PerEmailSleep)
+			if err := sleep(ctx, p.config.PerEmailSleep); err != nil {
+				return nil, err
+			}
 		}
+
+		perSummaries = append(perSummaries, p.summaryBlock(newsletter, summary))
+		processedItems = append(processedItems, newsletter)
 	}
 
 	// Fetch LinkedIn content if enabled
 	var linkedInSummaries []string
+	var filteredPosts []FilteredPost
 	shouldFetchLinkedIn := p.config.FetchLinkedInHashtags && len(p.config.LinkedInHashtags) > 0 &&
 		(len(newsletters) > 0 || p.config.LinkedInOnlyMode)
 
 	if shouldFetchLinkedIn {
-		linkedInContent, err := p.fetchLinkedInContent(ctx)
+		linkedInContent, filtered, err := p.fetchLinkedInContent(ctx, cp)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		if err != nil {
-			fmt.Printf("Error fetching LinkedIn content: %v\n", err)
+			p.logger.ErrorContext(ctx, "fetch LinkedIn content failed", "hashtags", p.config.LinkedInHashtags, "error", err)
 		} else {
 			linkedInSummaries = linkedInContent
+			filteredPosts = filtered
 		}
 	}
 
@@ -70,23 +139,39 @@ func (p *Processor) ProcessNewsletters(ctx context.Context, newsletters []*model
 
 	if len(allSummaries) == 0 {
 		if p.config.LinkedInOnlyMode && p.config.FetchLinkedInHashtags {
-			return "", nil, fmt.Errorf("no content found: no newsletters and LinkedIn fetching failed")
+			return nil, fmt.Errorf("no content found: no newsletters and LinkedIn fetching failed")
 		}
-		return "", nil, fmt.Errorf("no usable content extracted")
+		return nil, fmt.Errorf("no usable content extracted")
 	}
 
 	// Determine digest type for email subject
 	digestType := p.determineDigestType(len(perSummaries), len(linkedInSummaries))
 
-	finalHTML, err := p.synthesizeFinal(ctx, allSummaries, processedItems, digestType)
+	result := &Result{
+		Summaries:     allSummaries,
+		Items:         processedItems,
+		LinkedInCount: len(linkedInSummaries),
+		DigestType:    digestType,
+		Skipped:       skipped,
+		FilteredPosts: filteredPosts,
+	}
+
+	finalHTML, rawText, err := p.synthesizeFinal(ctx, allSummaries, processedItems, digestType)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		// fallback to raw bullets
-		return p.createFallbackHTML(allSummaries, digestType), processedItems, nil
+		p.logger.ErrorContext(ctx, "final synthesis failed, sending raw summaries", "model", p.config.FinalModel, "error", err)
+		result.HTML = p.createFallbackHTML(allSummaries, digestType)
+		result.Fallback = true
+		return result, nil
 	}
+	result.RawText = rawText
 
 	// Add verification footer and optional sample
-	if v := validator.ValidateOutput(finalHTML); v != "" {
-		log.Printf("validator: %s", v)
+	if v := validator.ValidateOutput(finalHTML, p.config.DigestSections()); v != "" {
+		p.logger.WarnContext(ctx, "digest validation failed", "problem", v)
 	}
 
 	// Insert footer before closing body tag (we know the structure now)
@@ -101,7 +186,8 @@ func (p *Processor) ProcessNewsletters(ctx context.Context, newsletters []*model
 		finalHTML = strings.Replace(finalHTML, "</body>", footerHTML+"</body>", 1)
 	}
 
-	return finalHTML, processedItems, nil
+	result.HTML = finalHTML
+	return result, nil
 }
 
 func (p *Processor) determineDigestType(newsletterCount, linkedInCount int) string {
@@ -115,105 +201,172 @@ func (p *Processor) determineDigestType(newsletterCount, linkedInCount int) stri
 	return "Empty"
 }
 
+// byPriority returns the newsletters ordered by the priority of their sender
+// rules, highest first, so that they come first in the synthesis input.
+// Newsletters of equal priority keep their order.
+func (p *Processor) byPriority(newsletters []*models.Newsletter) []*models.Newsletter {
+	newsletters = slices.Clone(newsletters)
+	slices.SortStableFunc(newsletters, func(a, b *models.Newsletter) int {
+		return p.senderRule(b).Priority - p.senderRule(a).Priority
+	})
+	return newsletters
+}
+
+// senderRule returns the sender rule for a newsletter, or an empty rule
+func (p *Processor) senderRule(n *models.Newsletter) config.SenderRule {
+	if r := p.config.SenderRule(n.From, n.ListID); r != nil {
+		return *r
+	}
+	return config.SenderRule{}
+}
+
+// summaryBlock formats a newsletter summary for the synthesis, with the
+// instructions of its sender rule
+func (p *Processor) summaryBlock(n *models.Newsletter, summary string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n", n.Subject)
+	rule := p.senderRule(n)
+	if s, ok := config.MatchSection(p.config.Sections, rule.Section); ok {
+		fmt.Fprintf(&b, "(Put this newsletter under === %s ===)\n", s.Name)
+	}
+	if rule.Include == config.IncludeAlways {
+		b.WriteString("(Always include this newsletter in the digest)\n")
+	}
+	fmt.Fprintf(&b, "%s\nLinks:\n%s", summary, strings.Join(n.Links, "\n"))
+	return b.String()
+}
+
 func (p *Processor) summarizeSingle(ctx context.Context, newsletter *models.Newsletter) (string, error) {
 	body := utils.CleanText(newsletter.Text)
 	if len(body) == 0 {
 		return "", fmt.Errorf("empty body")
 	}
 
+	rule := p.senderRule(newsletter)
+	fetchFull, maxChars := p.config.FetchFullContent, p.config.PerEmailMaxChars
+	if rule.FetchFullContent != nil {
+		fetchFull = *rule.FetchFullContent
+	}
+	if rule.MaxChars > 0 {
+		maxChars = rule.MaxChars
+	}
+
 	// Check if we should fetch additional content (e.g., LinkedIn articles)
-	if p.config.FetchFullContent {
+	if fetchFull {
 		if shouldFetch, url := p.contentFetcher.ShouldFetchContent(body, newsletter.Links); shouldFetch {
-			if fullContent, err := p.contentFetcher.FetchLinkedInContent(url); err == nil {
+			fullContent, err := p.contentFetcher.FetchLinkedInContent(ctx, url)
+			if err != nil {
+				p.logger.WarnContext(ctx, "fetch full article failed, using teaser",
+					"message_id", newsletter.ID, "url", url, "error", err)
+			} else {
 				// Combine the teaser with the full content
 				body = body + "\n\n--- Full Article Content ---\n" + fullContent
 			}
 		}
 	}
 
-	if len(body) > p.config.PerEmailMaxChars {
-		body = body[:p.config.PerEmailMaxChars]
+	if len(body) > maxChars {
+		body = body[:maxChars]
 	}
 
-	var lb strings.Builder
-	if len(newsletter.Links) > 0 {
-		lb.WriteString("Relevant links:\n")
-		for i := range newsletter.Links {
-			lb.WriteString(fmt.Sprintf("[L%d] %s\n", i+1, newsletter.Links[i]))
-		}
-		lb.WriteString("\n")
+	data := prompts.Newsletter{
+		Common:  p.promptCommon(),
+		Subject: newsletter.Subject,
+		From:    newsletter.From,
+		Date:    newsletter.Date,
+		Body:    body,
 	}
-
-	user := fmt.Sprintf(
-		"Subject: %s\nFrom: %s\nDate: %s\nSummarize this single newsletter into 3–6 crisp bullets. "+
-			"Emphasize Product Management, Healthcare, Architecture, Team Organization. "+
-			"Only include AI if it clearly impacts those. If a bullet references something with a URL, keep a short cue like [L1], [L2] inline (no HTML/Markdown), referring to the 'Relevant links' list.\n\n%s%s",
-		newsletter.Subject, newsletter.From, newsletter.Date, lb.String(), body,
-	)
-
-	messages := []openai.ChatMessage{
-		{Role: "system", Content: p.config.PromptSingle},
-		{Role: "user", Content: user},
+	for i, link := range newsletter.Links {
+		data.Links = append(data.Links, prompts.Link{Ref: fmt.Sprintf("L%d", i+1), URL: link})
+	}
+	messages, err := p.messages(prompts.Single, data)
+	if err != nil {
+		return "", err
+	}
+	if rule.Prompt != "" {
+		messages[0].Content = rule.Prompt
 	}
 
 	return p.openaiClient.Chat(ctx, p.config.SmallModel, messages, 0.1, 300)
 }
 
-func (p *Processor) fetchLinkedInContent(ctx context.Context) ([]string, error) {
+// fetchLinkedInContent returns summaries of the professional LinkedIn posts
+// for the configured hashtags, along with the posts that were filtered out
+func (p *Processor) fetchLinkedInContent(ctx context.Context, cp *checkpoint.Checkpoint) ([]string, []FilteredPost, error) {
 	// Fetch LinkedIn posts for the configured hashtags
-	posts, err := p.contentFetcher.FetchLinkedInHashtagContent(p.config.LinkedInHashtags, 15, p.config.LinkedInFetchFullContent) // Fetch more to account for filtering
+	posts, err := p.contentFetcher.FetchLinkedInHashtagContent(ctx, p.config.LinkedInHashtags, p.config.LinkedInFetchPosts, p.config.LinkedInFetchFullContent)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(posts) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Filter out promotional/advertising content if enabled
 	var filteredPosts []fetcher.LinkedInPost
+	var rejected []FilteredPost
 	if p.config.LinkedInFilterPromotional {
 		for _, post := range posts {
-			if p.isContentProfessional(ctx, post) {
+			if ok, reason := p.isContentProfessional(ctx, post); ok {
 				filteredPosts = append(filteredPosts, post)
+			} else {
+				p.logger.DebugContext(ctx, "filtered LinkedIn post", "author", post.Author, "url", post.URL, "reason", reason)
+				rejected = append(rejected, FilteredPost{Author: post.Author, URL: post.URL, Reason: reason})
 			}
 
 			// Limit to target number after filtering
-			if len(filteredPosts) >= 10 {
+			if len(filteredPosts) >= p.config.LinkedInMaxPosts {
 				break
 			}
 		}
 	} else {
-		// No filtering, use all posts but limit to 10
+		// No filtering, use all posts up to the limit
 		filteredPosts = posts
-		if len(filteredPosts) > 10 {
-			filteredPosts = filteredPosts[:10]
+		if len(filteredPosts) > p.config.LinkedInMaxPosts {
+			filteredPosts = filteredPosts[:p.config.LinkedInMaxPosts]
 		}
 	}
 
 	if len(filteredPosts) == 0 {
-		return nil, nil
+		return nil, rejected, nil
 	}
 
 	// Summarize each professional LinkedIn post
 	var summaries []string
 	for _, post := range filteredPosts {
+		if summary, ok := cp.Post(post.URL); ok {
+			summaries = append(summaries, fmt.Sprintf("### LinkedIn: %s\n%s\nSource: %s",
+				post.Author, summary, post.URL))
+			continue
+		}
+
 		summary, err := p.summarizeLinkedInPost(ctx, post)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			p.logger.WarnContext(ctx, "summarize LinkedIn post failed", "author", post.Author, "url", post.URL, "error", err)
+			rejected = append(rejected, FilteredPost{Author: post.Author, URL: post.URL, Reason: "summarize failed: " + err.Error()})
 			continue
 		}
+		if err := cp.SavePost(post.URL, summary); err != nil {
+			p.logger.WarnContext(ctx, "save checkpoint failed", "url", post.URL, "error", err)
+		}
 
 		summaries = append(summaries, fmt.Sprintf("### LinkedIn: %s\n%s\nSource: %s",
 			post.Author, summary, post.URL))
 	}
 
-	return summaries, nil
+	return summaries, rejected, nil
 }
 
-func (p *Processor) isContentProfessional(ctx context.Context, post fetcher.LinkedInPost) bool {
+// isContentProfessional reports whether post carries professional insight.
+// When it does not, the returned reason says which check rejected it.
+func (p *Processor) isContentProfessional(ctx context.Context, post fetcher.LinkedInPost) (bool, string) {
 	// Quick heuristics first (fast filtering)
 	if p.hasPromotionalIndicators(post.Text) {
-		return false
+		return false, "promotional keywords"
 	}
 
 	// Use AI for more sophisticated content analysis
@@ -257,40 +410,27 @@ func (p *Processor) hasPromotionalIndicators(text string) bool {
 	return count >= 3
 }
 
-func (p *Processor) aiContentFilter(ctx context.Context, post fetcher.LinkedInPost) bool {
+func (p *Processor) aiContentFilter(ctx context.Context, post fetcher.LinkedInPost) (bool, string) {
 	// Use AI to determine if content is professional insight vs. promotional
-	prompt := fmt.Sprintf(
-		"Analyze this LinkedIn post and determine if it contains valuable professional insights or if it's primarily promotional/advertising content.\n\n"+
-			"Post by: %s\n"+
-			"Content: %s\n\n"+
-			"Respond with exactly 'PROFESSIONAL' if the post contains:\n"+
-			"- Industry insights, trends, or analysis\n"+
-			"- Professional advice or best practices\n"+
-			"- Thought leadership or expert opinions\n"+
-			"- Educational content or case studies\n"+
-			"- News or developments in the field\n\n"+
-			"Respond with exactly 'PROMOTIONAL' if the post contains:\n"+
-			"- Product advertisements or sales pitches\n"+
-			"- Service promotions or marketing\n"+
-			"- Direct selling or lead generation\n"+
-			"- Event promotion (unless highly educational)\n"+
-			"- Generic company announcements\n\n"+
-			"Focus on the primary intent and value of the content.",
-		post.Author, post.Text)
-
-	messages := []openai.ChatMessage{
-		{Role: "system", Content: "You are a content quality filter for professional insights. Respond only with 'PROFESSIONAL' or 'PROMOTIONAL'."},
-		{Role: "user", Content: prompt},
-	}
-
-	response, err := p.openaiClient.Chat(ctx, p.config.SmallModel, messages, 0.1, 50)
+	messages, err := p.messages(prompts.Filter, prompts.Post{Common: p.promptCommon(), Author: post.Author, Text: post.Text})
+	var response string
+	if err == nil {
+		response, err = p.openaiClient.Chat(ctx, p.config.SmallModel, messages, 0.1, 50)
+	}
 	if err != nil {
 		// If AI fails, fall back to heuristics - err on side of inclusion for professional-looking content
-		return !p.hasStrongPromotionalLanguage(post.Text)
+		p.logger.WarnContext(ctx, "AI content filter failed, using heuristics", "url", post.URL, "error", err)
+		if p.hasStrongPromotionalLanguage(post.Text) {
+			return false, "strong promotional language (AI filter unavailable)"
+		}
+		return true, ""
 	}
 
 	response = strings.ToUpper(strings.TrimSpace(response))
-	return response == "PROFESSIONAL"
+	if response != "PROFESSIONAL" {
+		return false, "AI filter classified as " + response
+	}
+	return true, ""
 }
 
 func (p *Processor) hasStrongPromotionalLanguage(text string) bool {
@@ -309,6 +449,30 @@ func (p *Processor) hasStrongPromotionalLanguage(text string) bool {
 	return false
 }
 
+// promptCommon returns the template data shared by all prompts
+func (p *Processor) promptCommon() prompts.Common {
+	return prompts.Common{Audience: p.config.Audience, Sections: p.config.DigestSections()}
+}
+
+// messages renders the prompts of a kind. A system prompt set in the
+// configuration replaces the template.
+func (p *Processor) messages(k prompts.Kind, data any) ([]openai.ChatMessage, error) {
+	system, user, err := p.prompts.Render(k, data)
+	if err != nil {
+		return nil, fmt.Errorf("render %s prompt: %w", k, err)
+	}
+	switch {
+	case k == prompts.Single && p.config.PromptSingle != "":
+		system = p.config.PromptSingle
+	case k == prompts.Final && p.config.PromptFinal != "":
+		system = p.config.PromptFinal
+	}
+	return []openai.ChatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: user},
+	}, nil
+}
+
 func (p *Processor) truncateText(text string, maxLength int) string {
 	if len(text) <= maxLength {
 		return text
@@ -317,77 +481,59 @@ func (p *Processor) truncateText(text string, maxLength int) string {
 }
 
 func (p *Processor) summarizeLinkedInPost(ctx context.Context, post fetcher.LinkedInPost) (string, error) {
-	user := fmt.Sprintf(
-		"Author: %s\nHashtags: %s\nTimestamp: %s\nSummarize this LinkedIn post into 2-4 crisp bullets. "+
-			"Focus on insights relevant to Product Management, Healthcare, Architecture, Team Organization, or AI. "+
-			"Extract key takeaways and actionable insights. Keep it concise and professional.\n\nPost Content:\n%s",
-		post.Author, strings.Join(post.Hashtags, ", "), post.Timestamp, post.Text,
-	)
-
-	messages := []openai.ChatMessage{
-		{Role: "system", Content: "You summarize LinkedIn posts for a product executive. Focus on actionable insights and key trends. Return 2-4 short bullets as plain text lines (no HTML/Markdown)."},
-		{Role: "user", Content: user},
+	messages, err := p.messages(prompts.LinkedIn, prompts.Post{
+		Common:    p.promptCommon(),
+		Author:    post.Author,
+		Hashtags:  post.Hashtags,
+		Timestamp: post.Timestamp,
+		Text:      post.Text,
+	})
+	if err != nil {
+		return "", err
 	}
 
 	return p.openaiClient.Chat(ctx, p.config.SmallModel, messages, 0.1, 200)
 }
 
-func (p *Processor) synthesizeFinal(ctx context.Context, perSumm []string, meta []*models.Newsletter, digestType string) (string, error) {
+// synthesizeFinal returns the digest HTML and the plain-text model output it was parsed from
+func (p *Processor) synthesizeFinal(ctx context.Context, perSumm []string, meta []*models.Newsletter, digestType string) (string, string, error) {
 	// Build link index with global numbering
-	var li []string
+	data := prompts.Digest{
+		Common:     p.promptCommon(),
+		DigestType: digestType,
+		Content:    strings.Join(perSumm, Separator),
+	}
 	linkCounter := 1
 	for _, m := range meta {
 		if len(m.Links) == 0 {
 			continue
 		}
-		var lines []string
+		src := prompts.Source{Subject: m.Subject}
 		for _, u := range m.Links {
-			lines = append(lines, fmt.Sprintf("[L%d] %s", linkCounter, u))
+			src.Links = append(src.Links, prompts.Link{Ref: fmt.Sprintf("L%d", linkCounter), URL: u})
 			linkCounter++
 		}
-		li = append(li, fmt.Sprintf("%s\n%s", m.Subject, strings.Join(lines, "\n")))
-	}
-	linkIndex := strings.Join(li, "\n\n")
-	joined := strings.Join(perSumm, Separator)
-
-	system := p.config.PromptFinal
-	user := "Combine and rank the following content into a weekly digest, grouped in this EXACT order:\n" +
-		"1) === Product Management ===\n" +
-		"2) === Healthcare ===\n" +
-		"3) === Software Architecture ===\n" +
-		"4) === Team Organization ===\n" +
-		"5) === AI ===\n" +
-		"Content includes both newsletter summaries and LinkedIn insights. Merge related content into appropriate sections.\n" +
-		"IMPORTANT: For Software Architecture section - ONLY include content about software architecture, system design, cloud architecture, microservices, APIs, technical architecture, DevOps, infrastructure. DO NOT include building architecture, physical architecture, or construction-related content.\n" +
-		"Rules:\n" +
-		"- MUST generate ALL 5 sections above in exact order, even if brief\n" +
-		"- Follow each section header with bullet points starting with '- '\n" +
-		"- If no content for a section, add '- No significant updates this week'\n" +
-		"- Merge similar content from newsletters and LinkedIn posts\n" +
-		"- Preserve key facts/metrics, include short source names\n" +
-		"- Keep [L1], [L2] references as-is in the text for link replacement\n" +
-		"- No HTML, Markdown, or special formatting - just plain text\n\n" +
-		"=== CONTENT TO PROCESS ===\n" + joined +
-		"\n\n=== LINK INDEX (map [L*] to URLs) ===\n" + linkIndex + "\n\n" +
-		"Generate exactly 5 sections as specified above, combining newsletter and LinkedIn insights."
-
-	messages := []openai.ChatMessage{
-		{Role: "system", Content: system},
-		{Role: "user", Content: user},
+		data.Sources = append(data.Sources, src)
+	}
+
+	messages, err := p.messages(prompts.Final, data)
+	if err != nil {
+		return "", "", err
 	}
 
 	out, err := p.openaiClient.Chat(ctx, p.config.FinalModel, messages, 0.1, 2000)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
+	out = strings.TrimSpace(out)
 
 	// Parse the plain text and convert to HTML
-	htmlContent := p.parseTextToHTML(strings.TrimSpace(out), meta)
+	htmlContent := p.parseTextToHTML(out, meta)
 
 	// Build the complete HTML document ourselves
 	finalHTML := p.buildCompleteHTML(htmlContent, digestType)
 
-	return finalHTML, nil
+	return finalHTML, out, nil
 }
 
 func (p *Processor) parseTextToHTML(text string, meta []*models.Newsletter) string {
@@ -429,8 +575,12 @@ func (p *Processor) parseTextToHTML(text string, meta []*models.Newsletter) stri
 				html.WriteString("  </ul>\n")
 			}
 
-			// Extract section name
+			// Extract section name, using the configured name when the
+			// model wrote an alias
 			sectionName := strings.TrimSpace(strings.Trim(line, "="))
+			if s, ok := config.MatchSection(p.config.Sections, sectionName); ok {
+				sectionName = s.Name
+			}
 			html.WriteString(fmt.Sprintf("  <h2>%s</h2>\n", utils.HtmlEscape(sectionName)))
 			html.WriteString("  <ul>\n")
 			inSection = true
@@ -462,21 +612,6 @@ func (p *Processor) parseTextToHTML(text string, meta []*models.Newsletter) stri
 	return html.String()
 }
 
-func (p *Processor) detectSections(text string) []string {
-	var sections []string
-	lines := strings.Split(text, "\n")
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "===") && strings.HasSuffix(line, "===") {
-			sectionName := strings.TrimSpace(strings.Trim(line, "="))
-			sections = append(sections, sectionName)
-		}
-	}
-
-	return sections
-}
-
 func (p *Processor) buildCompleteHTML(content string, digestType string) string {
 	date := time.Now().Format("2006-01-02")
 
@@ -530,16 +665,17 @@ func (p *Processor) buildCompleteHTML(content string, digestType string) string
 	var metaText string
 	switch digestType {
 	case "LinkedIn":
-		metaText = "Industry insights from LinkedIn: Product Management → Healthcare → Software Architecture → Team Organization → AI"
+		metaText = "Industry insights from LinkedIn: "
 	case "Newsletter":
-		metaText = "Newsletter summary: Product Management → Healthcare → Software Architecture → Team Organization → AI"
+		metaText = "Newsletter summary: "
 	case "Combined":
-		metaText = "Combined insights from newsletters and LinkedIn: Product Management → Healthcare → Software Architecture → Team Organization → AI"
+		metaText = "Combined insights from newsletters and LinkedIn: "
 	default:
-		metaText = "Prioritized: Product Management → Healthcare → Software Architecture → Team Organization → AI"
+		metaText = "Prioritized: "
 	}
+	metaText += strings.Join(config.SectionNames(p.config.DigestSections()), " → ")
 
-	html.WriteString("  <div class=\"meta\">" + metaText + "</div>\n")
+	html.WriteString("  <div class=\"meta\">" + utils.HtmlEscape(metaText) + "</div>\n")
 
 	// Content from OpenAI
 	html.WriteString("  <div class=\"content\">\n")
@@ -623,9 +759,17 @@ func (p *Processor) appendPerEmailSample(html string, per []string) string {
 	return sb.String()
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// sleep waits for d unless ctx is cancelled first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
 	}
-	return b
 }
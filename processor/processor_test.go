@@ -0,0 +1,37 @@
+package processor
+
+import (
+	"slices"
+	"testing"
+
+	"newsletterdigest_go/config"
+	"newsletterdigest_go/models"
+)
+
+func TestByPriority(t *testing.T) {
+	cfg := config.Default()
+	cfg.Senders = []config.SenderRule{
+		{From: "vip@example.com", Priority: 10},
+		{ListID: "*.substack.com", Priority: 5},
+		{From: "low@example.com", Priority: -1},
+	}
+	p := &Processor{config: cfg}
+
+	newsletters := []*models.Newsletter{
+		{ID: "low", From: "low@example.com"},
+		{ID: "plain1", From: "a@example.com"},
+		{ID: "list", From: "writer@example.com", ListID: "<weekly.substack.com>"},
+		{ID: "plain2", From: "b@example.com"},
+		{ID: "vip", From: "VIP <vip@example.com>"},
+	}
+	var got []string
+	for _, n := range p.byPriority(newsletters) {
+		got = append(got, n.ID)
+	}
+	if want := []string{"vip", "list", "plain1", "plain2", "low"}; !slices.Equal(got, want) {
+		t.Errorf("byPriority = %v, want %v", got, want)
+	}
+	if newsletters[0].ID != "low" {
+		t.Error("byPriority reordered its input")
+	}
+}
@@ -0,0 +1,248 @@
+package prompts
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"newsletterdigest_go/config"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// Kind is a model call made while building a digest. Each kind has a system
+// and a user template, named <kind>.system.tmpl and <kind>.user.tmpl.
+type Kind string
+
+const (
+	Single   Kind = "single"   // summary of one newsletter, data Newsletter
+	LinkedIn Kind = "linkedin" // summary of one LinkedIn post, data Post
+	Filter   Kind = "filter"   // promotional content check of a LinkedIn post, data Post
+	Final    Kind = "final"    // synthesis of the digest, data Digest
+)
+
+// Kinds lists every kind of prompt
+var Kinds = []Kind{Single, LinkedIn, Filter, Final}
+
+// templates returns the file names of the system and user template of a kind
+func (k Kind) templates() [2]string {
+	return [2]string{string(k) + ".system.tmpl", string(k) + ".user.tmpl"}
+}
+
+// Common is the data every template receives
+type Common struct {
+	Audience string           // who the digest is for, e.g. "a product executive"
+	Sections []config.Section // digest sections in order
+}
+
+// Required returns the sections every digest must have
+func (c Common) Required() []config.Section {
+	return slices.DeleteFunc(slices.Clone(c.Sections), func(s config.Section) bool { return s.Optional })
+}
+
+// Optional returns the sections a digest may leave out
+func (c Common) Optional() []config.Section {
+	return slices.DeleteFunc(slices.Clone(c.Sections), func(s config.Section) bool { return !s.Optional })
+}
+
+// Link is a URL the model refers to by Ref, e.g. L3
+type Link struct {
+	Ref string
+	URL string
+}
+
+// Newsletter is the data of the Single templates
+type Newsletter struct {
+	Common
+	Subject string
+	From    string
+	Date    string
+	Links   []Link
+	Body    string
+}
+
+// Post is the data of the LinkedIn and Filter templates
+type Post struct {
+	Common
+	Author    string
+	Hashtags  []string
+	Timestamp string
+	Text      string
+}
+
+// Source lists the links of one newsletter in the digest's link index
+type Source struct {
+	Subject string
+	Links   []Link
+}
+
+// Digest is the data of the Final templates
+type Digest struct {
+	Common
+	DigestType string   // Newsletter, LinkedIn or Combined
+	Content    string   // the summaries, separated
+	Sources    []Source // newsletters with links, numbered across the digest
+}
+
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"inc":  func(i int) int { return i + 1 },
+	"names": func(sections []config.Section) []string {
+		return config.SectionNames(sections)
+	},
+}
+
+// Set holds the prompt templates of a digest
+type Set struct {
+	templates map[string]*template.Template
+	sources   map[string]string // where each template came from
+}
+
+// Load returns the embedded templates, replaced by the files of the same
+// name in dir when dir is set. Files in dir that are not a known template and
+// templates that do not parse are errors, all reported together.
+func Load(dir string) (*Set, error) {
+	s := &Set{
+		templates: make(map[string]*template.Template),
+		sources:   make(map[string]string),
+	}
+
+	known := make(map[string]bool)
+	var errs []error
+	for _, k := range Kinds {
+		for _, name := range k.templates() {
+			known[name] = true
+			text, err := fs.ReadFile(embedded, "templates/"+name)
+			if err != nil {
+				return nil, fmt.Errorf("embedded prompt %s: %w", name, err)
+			}
+			source := "embedded"
+			if dir != "" {
+				path := filepath.Join(dir, name)
+				override, err := os.ReadFile(path)
+				switch {
+				case err == nil:
+					text, source = override, path
+				case !errors.Is(err, fs.ErrNotExist):
+					errs = append(errs, fmt.Errorf("read prompt: %w", err))
+				}
+			}
+
+			t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(text))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", source, err))
+				continue
+			}
+			s.templates[name] = t
+			s.sources[name] = source
+		}
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read prompts directory: %w", err))
+		}
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), ".tmpl") && !known[e.Name()] {
+				errs = append(errs, fmt.Errorf("%s: unknown prompt template", filepath.Join(dir, e.Name())))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return s, nil
+}
+
+// Stamp returns a value that changes whenever a file in dir is added,
+// removed or modified, or "" when dir is not set
+func Stamp(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err.Error()
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", e.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+// Render returns the system and user prompt of a kind for data
+func (s *Set) Render(k Kind, data any) (system, user string, err error) {
+	names := k.templates()
+	if system, err = s.render(names[0], data); err != nil {
+		return "", "", err
+	}
+	if user, err = s.render(names[1], data); err != nil {
+		return "", "", err
+	}
+	return system, user, nil
+}
+
+func (s *Set) render(name string, data any) (string, error) {
+	t, ok := s.templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template %s", name)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("%s: %w", s.sources[name], err)
+	}
+	out := strings.TrimSpace(b.String())
+	if out == "" {
+		return "", fmt.Errorf("%s: renders to an empty prompt", s.sources[name])
+	}
+	return out, nil
+}
+
+// Source returns where the system and user templates of a kind were loaded
+// from: a file path, or "embedded"
+func (s *Set) Source(k Kind) (system, user string) {
+	names := k.templates()
+	return s.sources[names[0]], s.sources[names[1]]
+}
+
+// Sample returns example data for a kind, used to check templates before a run
+func Sample(k Kind, common Common) any {
+	switch k {
+	case Single:
+		return Newsletter{
+			Common:  common,
+			Subject: "Weekly product notes",
+			From:    "Product Weekly <news@example.com>",
+			Date:    "Mon, 2 Jun 2025 08:00:00 +0000",
+			Links:   []Link{{Ref: "L1", URL: "https://example.com/article"}},
+			Body:    "This week: pricing experiments, discovery interviews and a new roadmap format.",
+		}
+	case LinkedIn, Filter:
+		return Post{
+			Common:    common,
+			Author:    "Jane Doe",
+			Hashtags:  []string{"productmanagement"},
+			Timestamp: "2025-06-02T08:00:00Z",
+			Text:      "Three lessons from moving our platform team to a product operating model.",
+		}
+	default:
+		return Digest{
+			Common:     common,
+			DigestType: "Combined",
+			Content:    "- Pricing experiments pay off [L1]\n\n——————————————————\n\n- Platform teams as products",
+			Sources:    []Source{{Subject: "Weekly product notes", Links: []Link{{Ref: "L1", URL: "https://example.com/article"}}}},
+		}
+	}
+}
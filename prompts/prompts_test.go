@@ -0,0 +1,103 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"newsletterdigest_go/config"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	set, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	common := Common{Audience: "a CTO", Sections: config.DefaultSections}
+	for _, k := range Kinds {
+		system, user, err := set.Render(k, Sample(k, common))
+		if err != nil {
+			t.Fatalf("Render %s failed: %v", k, err)
+		}
+		if system == "" || user == "" {
+			t.Errorf("Expected %s prompts, got %q / %q", k, system, user)
+		}
+	}
+
+	system, user, _ := set.Render(Final, Sample(Final, common))
+	if !strings.Contains(system, "for a CTO") || !strings.Contains(system, "ALL 4 required sections") {
+		t.Errorf("Unexpected final system prompt %q", system)
+	}
+	if !strings.Contains(user, "5) === AI === (optional)") || !strings.Contains(user, "[L1] https://example.com/article") {
+		t.Errorf("Unexpected final user prompt %q", user)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	write("single.user.tmpl", "Summarize {{.Subject}} from {{.From}}:\n{{.Body}}\n")
+	set, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	_, user, err := set.Render(Single, Newsletter{Subject: "Notes", From: "a@example.com", Body: "text"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if user != "Summarize Notes from a@example.com:\ntext" {
+		t.Errorf("Expected the override to be used, got %q", user)
+	}
+	if system, userSrc := set.Source(Single); system != "embedded" || userSrc != filepath.Join(dir, "single.user.tmpl") {
+		t.Errorf("Unexpected sources %q, %q", system, userSrc)
+	}
+
+	// Fields that do not exist fail when rendering
+	write("single.user.tmpl", "{{.Sender}}")
+	set, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, _, err := set.Render(Single, Sample(Single, Common{Sections: config.DefaultSections})); err == nil {
+		t.Error("Expected error rendering an unknown field")
+	}
+
+	write("final.user.tmpl", "{{range .Sections}")
+	write("finale.user.tmpl", "typo")
+	_, err = Load(dir)
+	if err == nil {
+		t.Fatal("Expected Load to fail")
+	}
+	for _, want := range []string{"final.user.tmpl", "finale.user.tmpl: unknown prompt template"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected problem %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestStamp(t *testing.T) {
+	if got := Stamp(""); got != "" {
+		t.Errorf("Stamp without a directory = %q, want empty", got)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "final.system.tmpl")
+	if err := os.WriteFile(path, []byte("one"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	before := Stamp(dir)
+	if err := os.WriteFile(path, []byte("longer"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if Stamp(dir) == before {
+		t.Error("Expected the stamp to change with the template")
+	}
+}
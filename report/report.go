@@ -0,0 +1,104 @@
+// Package report describes what a dry run would have done
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"newsletterdigest_go/models"
+	"newsletterdigest_go/processor"
+)
+
+// Message identifies a Gmail message in the report
+type Message struct {
+	ID      string `json:"id"`
+	Subject string `json:"subject"`
+	From    string `json:"from"`
+}
+
+// Email describes the digest that would have been sent
+type Email struct {
+	To         string `json:"to"`
+	Subject    string `json:"subject"`
+	DigestType string `json:"digest_type"`
+	Bytes      int    `json:"bytes"`
+	Fallback   bool   `json:"fallback"`
+}
+
+// DryRun is the simulation report printed instead of performing outward actions
+type DryRun struct {
+	Profile        string                   `json:"profile"`
+	Query          string                   `json:"query"`
+	Matched        []string                 `json:"matched"`
+	Included       []Message                `json:"included"`
+	Skipped        []models.Skipped         `json:"skipped"`
+	LinkedInPosts  int                      `json:"linkedin_posts"`
+	FilteredPosts  []processor.FilteredPost `json:"filtered_posts"`
+	Email          *Email                   `json:"email,omitempty"`
+	WouldMarkRead  []string                 `json:"would_mark_read"`
+	CacheWritesOff bool                     `json:"cache_writes_disabled"`
+}
+
+// Included converts newsletters into report messages
+func Included(items []*models.Newsletter) []Message {
+	out := make([]Message, 0, len(items))
+	for _, it := range items {
+		out = append(out, Message{ID: it.ID, Subject: it.Subject, From: it.From})
+	}
+	return out
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *DryRun) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report in a human-readable layout
+func (r *DryRun) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "=== Dry run report: %s ===\n", r.Profile)
+	fmt.Fprintf(&b, "Query: %s\n", r.Query)
+	fmt.Fprintf(&b, "Matched messages: %d\n", len(r.Matched))
+
+	fmt.Fprintf(&b, "\nIncluded newsletters (%d):\n", len(r.Included))
+	for _, m := range r.Included {
+		fmt.Fprintf(&b, "  %s  %s — %s\n", m.ID, m.Subject, m.From)
+	}
+
+	fmt.Fprintf(&b, "\nSkipped messages (%d):\n", len(r.Skipped))
+	for _, s := range r.Skipped {
+		label := s.Subject
+		if label == "" {
+			label = "(not fetched)"
+		}
+		fmt.Fprintf(&b, "  %s  %s: %s\n", s.ID, label, s.Reason)
+	}
+
+	fmt.Fprintf(&b, "\nLinkedIn posts included: %d\n", r.LinkedInPosts)
+	fmt.Fprintf(&b, "LinkedIn posts filtered (%d):\n", len(r.FilteredPosts))
+	for _, p := range r.FilteredPosts {
+		fmt.Fprintf(&b, "  %s  %s: %s\n", p.Author, p.URL, p.Reason)
+	}
+
+	b.WriteString("\nEmail:\n")
+	if r.Email == nil {
+		b.WriteString("  nothing would be sent\n")
+	} else {
+		fmt.Fprintf(&b, "  to:      %s\n", r.Email.To)
+		fmt.Fprintf(&b, "  subject: %s\n", r.Email.Subject)
+		fmt.Fprintf(&b, "  type:    %s (%d bytes, fallback=%v)\n", r.Email.DigestType, r.Email.Bytes, r.Email.Fallback)
+	}
+
+	fmt.Fprintf(&b, "\nWould mark as read (%d): %s\n", len(r.WouldMarkRead), strings.Join(r.WouldMarkRead, ", "))
+	if r.CacheWritesOff {
+		b.WriteString("LinkedIn API cache writes were disabled.\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,104 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"newsletterdigest_go/models"
+)
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		name    string
+		rep     *DryRun
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "nothing to send",
+			rep:  &DryRun{Profile: "default", Query: "label:newsletter is:unread"},
+			want: []string{
+				"=== Dry run report: default ===",
+				"Query: label:newsletter is:unread",
+				"Matched messages: 0",
+				"Included newsletters (0):",
+				"  nothing would be sent",
+				"Would mark as read (0): \n",
+			},
+			notWant: []string{"cache writes were disabled"},
+		},
+		{
+			name: "digest",
+			rep: &DryRun{
+				Profile:       "product",
+				Matched:       []string{"m1", "m2", "m3"},
+				Included:      []Message{{ID: "m1", Subject: "Weekly notes", From: "news@example.com"}},
+				Skipped:       []models.Skipped{{ID: "m2", Subject: "Teaser", Reason: "body too short"}, {ID: "m3", Reason: "fetch failed"}},
+				LinkedInPosts: 4,
+				Email:         &Email{To: "pm@example.com", Subject: "Weekly Digest (product)", DigestType: "newsletters", Bytes: 1234},
+				WouldMarkRead: []string{"m1"},
+			},
+			want: []string{
+				"Matched messages: 3",
+				"  m1  Weekly notes — news@example.com",
+				"  m2  Teaser: body too short",
+				"  m3  (not fetched): fetch failed",
+				"LinkedIn posts included: 4",
+				"  to:      pm@example.com",
+				"  subject: Weekly Digest (product)",
+				"  type:    newsletters (1234 bytes, fallback=false)",
+				"Would mark as read (1): m1",
+			},
+			notWant: []string{"nothing would be sent"},
+		},
+		{
+			name: "cache writes off",
+			rep:  &DryRun{Profile: "default", CacheWritesOff: true},
+			want: []string{"LinkedIn API cache writes were disabled."},
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := tt.rep.WriteText(&buf); err != nil {
+			t.Fatalf("%s: WriteText failed: %v", tt.name, err)
+		}
+		out := buf.String()
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: expected %q in:\n%s", tt.name, want, out)
+			}
+		}
+		for _, notWant := range tt.notWant {
+			if strings.Contains(out, notWant) {
+				t.Errorf("%s: unexpected %q in:\n%s", tt.name, notWant, out)
+			}
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	rep := &DryRun{
+		Profile:       "default",
+		Matched:       []string{"m1"},
+		Included:      Included([]*models.Newsletter{{ID: "m1", Subject: "Weekly notes", From: "news@example.com", Text: "body"}}),
+		WouldMarkRead: []string{"m1"},
+	}
+	var buf bytes.Buffer
+	if err := rep.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("Output is not JSON: %v", err)
+	}
+	if _, ok := got["email"]; ok {
+		t.Error("Expected no email when nothing would be sent")
+	}
+	included, _ := got["included"].([]any)
+	if len(included) != 1 || included[0].(map[string]any)["subject"] != "Weekly notes" {
+		t.Errorf("Unexpected included newsletters %v", got["included"])
+	}
+}
@@ -0,0 +1,233 @@
+// Package scheduler runs jobs on cron schedules inside a long-lived process
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// StateFile is the name of the file recording each job's last run
+const StateFile = "daemon_state.json"
+
+// tickInterval is how often the wall clock is compared against the schedules.
+// Polling instead of sleeping until the next run notices suspended machines.
+const tickInterval = 30 * time.Second
+
+// lateGrace is how far past its scheduled time a run may start before it
+// counts as missed
+const lateGrace = 5 * time.Minute
+
+// Job is a named task run on a cron schedule
+type Job struct {
+	Name string
+	Spec string // standard 5-field cron expression, e.g. "0 7 * * MON"
+	Run  func(ctx context.Context) error
+}
+
+// Scheduler runs jobs on their schedules. A job never overlaps with itself:
+// a trigger that arrives while the previous run is still going is skipped.
+type Scheduler struct {
+	jobs      []*job
+	statePath string
+	catchUp   bool
+	logger    *slog.Logger
+
+	mu    sync.Mutex
+	state map[string]time.Time
+	wg    sync.WaitGroup
+}
+
+type job struct {
+	Job
+	schedule cron.Schedule
+	next     time.Time
+
+	running sync.Mutex
+}
+
+// New creates a scheduler persisting last run times in stateDir. With catchUp,
+// a job whose scheduled time passed while the process was down or the machine
+// was asleep runs once as soon as that is detected; otherwise it is only logged.
+func New(stateDir string, catchUp bool, logger *slog.Logger, jobs ...Job) (*Scheduler, error) {
+	if len(jobs) == 0 {
+		return nil, errors.New("no jobs to schedule")
+	}
+
+	s := &Scheduler{
+		statePath: filepath.Join(stateDir, StateFile),
+		catchUp:   catchUp,
+		logger:    logger.With("component", "daemon"),
+		state:     make(map[string]time.Time),
+	}
+
+	for _, j := range jobs {
+		sched, err := Parse(j.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", j.Name, err)
+		}
+		s.jobs = append(s.jobs, &job{Job: j, schedule: sched})
+	}
+
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Parse parses a standard 5-field cron expression or a descriptor such as @daily
+func Parse(spec string) (cron.Schedule, error) {
+	if spec == "" {
+		return nil, errors.New("empty schedule")
+	}
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return sched, nil
+}
+
+// Missed reports whether a run scheduled after last should already have
+// started by now, returning the earliest such time
+func Missed(sched cron.Schedule, last, now time.Time) (time.Time, bool) {
+	if last.IsZero() {
+		return time.Time{}, false
+	}
+	next := sched.Next(last)
+	return next, now.Sub(next) > lateGrace
+}
+
+// Run blocks until ctx is cancelled, then waits for running jobs to return.
+// Cancelling ctx only stops new runs: jobs already started run to completion.
+func (s *Scheduler) Run(ctx context.Context) error {
+	now := time.Now()
+	for _, j := range s.jobs {
+		last := s.lastRun(j.Name)
+		if missedAt, ok := Missed(j.schedule, last, now); ok {
+			s.handleMissed(ctx, j, missedAt)
+		}
+		j.next = j.schedule.Next(now)
+		s.logger.Info("job scheduled", "job", j.Name, "schedule", j.Spec, "next_run", j.next)
+	}
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("stopping, waiting for running jobs")
+			s.wg.Wait()
+			return nil
+		case <-ticker.C:
+			s.tick(ctx, time.Now())
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context, now time.Time) {
+	for _, j := range s.jobs {
+		if now.Before(j.next) {
+			continue
+		}
+
+		if now.Sub(j.next) > lateGrace {
+			s.handleMissed(ctx, j, j.next)
+		} else {
+			s.start(ctx, j)
+		}
+		j.next = j.schedule.Next(now)
+		s.logger.Info("job rescheduled", "job", j.Name, "next_run", j.next)
+	}
+}
+
+func (s *Scheduler) handleMissed(ctx context.Context, j *job, at time.Time) {
+	if !s.catchUp {
+		s.logger.Warn("missed scheduled run (catch-up disabled)", "job", j.Name, "scheduled_at", at)
+		// Record the skipped run, so the next start does not report it again
+		if err := s.recordRun(j.Name, time.Now()); err != nil {
+			s.logger.Error("save daemon state failed", "error", err)
+		}
+		return
+	}
+	s.logger.Warn("missed scheduled run, catching up once", "job", j.Name, "scheduled_at", at)
+	s.start(ctx, j)
+}
+
+// start runs j in the background unless its previous run is still going. The
+// run does not see the cancellation of ctx, so that stopping the daemon lets
+// a digest that is halfway through finish.
+func (s *Scheduler) start(ctx context.Context, j *job) {
+	if !j.running.TryLock() {
+		s.logger.Warn("run skipped: previous run still in progress", "job", j.Name)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer j.running.Unlock()
+
+		started := time.Now()
+		s.logger.Info("job started", "job", j.Name)
+		if err := j.Run(context.WithoutCancel(ctx)); err != nil {
+			s.logger.Error("job failed", "job", j.Name, "duration", time.Since(started).Round(time.Second), "error", err)
+		} else {
+			s.logger.Info("job finished", "job", j.Name, "duration", time.Since(started).Round(time.Second))
+		}
+
+		// Failed runs count as runs too: the schedule moved on and catch-up
+		// should not retry them on the next start
+		if err := s.recordRun(j.Name, started); err != nil {
+			s.logger.Error("save daemon state failed", "error", err)
+		}
+	}()
+}
+
+func (s *Scheduler) lastRun(name string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state[name]
+}
+
+func (s *Scheduler) loadState() error {
+	data, err := os.ReadFile(s.statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read daemon state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return fmt.Errorf("parse daemon state: %w", err)
+	}
+	return nil
+}
+
+func (s *Scheduler) recordRun(name string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state[name] = at
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.statePath), 0700); err != nil {
+		return err
+	}
+	tmp := s.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.statePath)
+}
@@ -0,0 +1,156 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"newsletterdigest_go/logging"
+)
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("0 7 * * MON"); err != nil {
+		t.Errorf("Parse failed for valid schedule: %v", err)
+	}
+	if _, err := Parse("@daily"); err != nil {
+		t.Errorf("Parse failed for descriptor: %v", err)
+	}
+	if _, err := Parse("not a schedule"); err == nil {
+		t.Error("Expected error for invalid schedule")
+	}
+	if _, err := Parse(""); err == nil {
+		t.Error("Expected error for empty schedule")
+	}
+}
+
+func TestMissed(t *testing.T) {
+	sched, err := Parse("0 7 * * MON")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// Monday 2024-11-04 07:00 ran; the next run is Monday 2024-11-11 07:00
+	last := time.Date(2024, 11, 4, 7, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name string
+		last time.Time
+		now  time.Time
+		want bool
+	}{
+		{"never ran", time.Time{}, last.AddDate(0, 1, 0), false},
+		{"before next run", last, last.AddDate(0, 0, 6), false},
+		{"within grace period", last, last.AddDate(0, 0, 7).Add(time.Minute), false},
+		{"slept through next run", last, last.AddDate(0, 0, 7).Add(time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := Missed(sched, tt.last, tt.now); got != tt.want {
+				t.Errorf("Missed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoOverlap(t *testing.T) {
+	var runs atomic.Int32
+	release := make(chan struct{})
+	stateDir := t.TempDir()
+
+	s, err := New(stateDir, false, logging.Discard(), Job{
+		Name: "test",
+		Spec: "* * * * *",
+		Run: func(ctx context.Context) error {
+			runs.Add(1)
+			<-release
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx := context.Background()
+	s.start(ctx, s.jobs[0])
+	s.start(ctx, s.jobs[0])
+	close(release)
+	s.wg.Wait()
+
+	if got := runs.Load(); got != 1 {
+		t.Errorf("Expected 1 run while the first was in progress, got %d", got)
+	}
+
+	if s.lastRun("test").IsZero() {
+		t.Error("Expected last run to be recorded")
+	}
+
+	// A new scheduler over the same directory sees the recorded run
+	s2, err := New(stateDir, false, logging.Discard(), Job{Name: "test", Spec: "* * * * *", Run: func(context.Context) error { return nil }})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if s2.lastRun("test").IsZero() {
+		t.Error("Expected last run to be loaded from state file")
+	}
+}
+
+func TestRunOutlivesCancel(t *testing.T) {
+	done := make(chan error, 1)
+	s, err := New(t.TempDir(), false, logging.Discard(), Job{
+		Name: "test",
+		Spec: "* * * * *",
+		Run: func(ctx context.Context) error {
+			time.Sleep(50 * time.Millisecond)
+			done <- ctx.Err()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.start(ctx, s.jobs[0])
+	cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("job context was cancelled with the daemon: %v", err)
+		}
+	default:
+		t.Error("Run returned before the running job finished")
+	}
+}
+
+func TestMissedRunRecordedWithoutCatchUp(t *testing.T) {
+	stateDir := t.TempDir()
+	s, err := New(stateDir, false, logging.Discard(), Job{Name: "test", Spec: "0 7 * * *", Run: func(context.Context) error {
+		t.Error("missed run started with catch-up disabled")
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := s.recordRun("test", time.Now().Add(-72*time.Hour)); err != nil {
+		t.Fatalf("recordRun failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	s2, err := New(stateDir, false, logging.Discard(), Job{Name: "test", Spec: "0 7 * * *", Run: func(context.Context) error { return nil }})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, missed := Missed(s2.jobs[0].schedule, s2.lastRun("test"), time.Now()); missed {
+		t.Error("skipped run is reported as missed again after a restart")
+	}
+}
@@ -2,38 +2,28 @@ package validator
 
 import (
 	"strings"
+
+	"newsletterdigest_go/config"
+	"newsletterdigest_go/utils"
 )
 
-func ValidateOutput(html string) string {
-	must := []string{"Product Management", "Healthcare", "Architecture", "Team Organization"}
-	for _, h := range must {
-		if !strings.Contains(html, "<h2>"+h+"</h2>") {
-			return "Missing required section: " + h
-		}
-	}
-	
-	aiPos := strings.Index(html, "<h2>AI")
-	if aiPos != -1 {
-		pm := strings.Index(html, "<h2>Product Management</h2>")
-		hc := strings.Index(html, "<h2>Healthcare</h2>")
-		ar := strings.Index(html, "<h2>Architecture</h2>")
-		to := strings.Index(html, "<h2>Team Organization</h2>")
-		order := []int{pm, hc, ar, to, aiPos}
-		ok := true
-		prev := -1
-		for _, p := range order {
-			if p == -1 {
+// ValidateOutput checks that the digest has a heading for every required
+// section and that the headings present follow the given order. It returns a
+// description of the first problem found.
+func ValidateOutput(html string, sections []config.Section) string {
+	prev, prevName := -1, ""
+	for _, s := range sections {
+		pos := strings.Index(html, "<h2>"+utils.HtmlEscape(s.Name)+"</h2>")
+		if pos == -1 {
+			if s.Optional {
 				continue
 			}
-			if p < prev {
-				ok = false
-				break
-			}
-			prev = p
+			return "Missing required section: " + s.Name
 		}
-		if !ok {
-			return "AI section appears before higher-priority sections."
+		if pos < prev {
+			return "Section " + s.Name + " appears before " + prevName + "."
 		}
+		prev, prevName = pos, s.Name
 	}
 	return ""
 }
@@ -0,0 +1,30 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"newsletterdigest_go/config"
+)
+
+func TestValidateOutput(t *testing.T) {
+	sections := []config.Section{
+		{Name: "Product Management"},
+		{Name: "Software Architecture & Design"},
+		{Name: "AI", Optional: true},
+	}
+
+	html := "<h2>Product Management</h2><h2>Software Architecture &amp; Design</h2>"
+	if v := ValidateOutput(html, sections); v != "" {
+		t.Errorf("Expected optional section to be allowed missing, got %q", v)
+	}
+	if v := ValidateOutput(html+"<h2>AI</h2>", sections); v != "" {
+		t.Errorf("ValidateOutput failed: %v", v)
+	}
+	if v := ValidateOutput("<h2>AI</h2>"+html, sections); !strings.Contains(v, "AI appears before") {
+		t.Errorf("Expected out-of-order section to be reported, got %q", v)
+	}
+	if v := ValidateOutput("<h2>Product Management</h2>", sections); !strings.Contains(v, "Missing required section") {
+		t.Errorf("Expected missing section to be reported, got %q", v)
+	}
+}